@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/vidsy/go-kmsconfig/v6/kmsconfig"
+)
+
+func (c *cli) diff(args []string) error {
+	var flags configFlags
+	flagSet := c.flagSet("diff", &flags)
+	decrypt := flagSet.Bool("decrypt", false, "decrypt secure values and compare hashes of their plaintext")
+
+	positional, err := parseArgs(flagSet, args)
+	if err != nil {
+		return err
+	}
+
+	if len(positional) != 2 {
+		return fmt.Errorf("expected two environments to compare, e.g. 'staging live'")
+	}
+
+	configs := make([]*kmsconfig.Config, 0, len(positional))
+	for _, env := range positional {
+		envFlags := flags
+		envFlags.env = env
+
+		config, err := c.newConfig(envFlags)
+		if err != nil {
+			return err
+		}
+
+		err = config.Read()
+		if err != nil {
+			return err
+		}
+
+		configs = append(configs, config)
+	}
+
+	differences, err := kmsconfig.Diff(configs[0], configs[1], *decrypt)
+	if err != nil {
+		return err
+	}
+
+	for _, difference := range differences {
+		fmt.Fprintf(
+			c.stdout,
+			"%s: %s differs: %s=%s %s=%s\n",
+			difference.Node,
+			difference.Kind,
+			positional[0],
+			difference.A,
+			positional[1],
+			difference.B,
+		)
+	}
+
+	if len(differences) > 0 {
+		return fmt.Errorf("%d difference(s) between %s and %s", len(differences), positional[0], positional[1])
+	}
+
+	return nil
+}
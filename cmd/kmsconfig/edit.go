@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func (c *cli) edit(args []string) error {
+	var flags configFlags
+	flagSet := c.flagSet("edit", &flags)
+	keyID := flagSet.String("key-id", os.Getenv("KMSCONFIG_KEY_ID"), "KMS key ID, alias or ARN for new secure values, defaults to the key a changed value was encrypted under")
+
+	positional, err := parseArgs(flagSet, args)
+	if err != nil {
+		return err
+	}
+
+	if len(positional) != 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(positional, " "))
+	}
+
+	config, err := c.newConfig(flags)
+	if err != nil {
+		return err
+	}
+
+	err = config.Read()
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	err = config.Edit(*keyID, func(plaintext []byte) ([]byte, error) {
+		editedPlaintext, err := c.openEditor(config.Env, plaintext)
+		if err != nil {
+			return nil, err
+		}
+
+		changed = !bytes.Equal(plaintext, editedPlaintext)
+		return editedPlaintext, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if !changed {
+		fmt.Fprintln(c.stderr, "No changes made")
+		return nil
+	}
+
+	return config.Save()
+}
+
+// openEditor writes the plaintext to a temporary file only readable by the
+// current user, opens it in $VISUAL or $EDITOR and returns the saved
+// contents. The file is removed once the editor exits.
+func (c *cli) openEditor(env string, plaintext []byte) ([]byte, error) {
+	file, err := os.CreateTemp("", fmt.Sprintf("kmsconfig-%s-*.json", env))
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(plaintext)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	editor := strings.Fields(editorCommand())
+	cmd := exec.Command(editor[0], append(editor[1:], file.Name())...)
+	cmd.Stdin = c.stdin
+	cmd.Stdout = c.stdout
+	cmd.Stderr = c.stderr
+
+	err = cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("error running editor: %s", err)
+	}
+
+	return os.ReadFile(file.Name())
+}
+
+func editorCommand() string {
+	for _, variable := range []string{"VISUAL", "EDITOR"} {
+		if editor := strings.TrimSpace(os.Getenv(variable)); editor != "" {
+			return editor
+		}
+	}
+
+	return "vi"
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func (c *cli) encrypt(args []string) error {
+	var flags configFlags
+	flagSet := c.flagSet("encrypt", &flags)
+	keyID := flagSet.String("key-id", os.Getenv("KMSCONFIG_KEY_ID"), "KMS key ID, alias or ARN, or age recipient with an age --key-file, defaults to $KMSCONFIG_KEY_ID")
+	node := flagSet.String("node", "", "node the value is for, e.g. 'app.db_password', to bind it to with --encryption-context")
+
+	positional, err := parseArgs(flagSet, args)
+	if err != nil {
+		return err
+	}
+
+	if len(positional) > 1 {
+		return fmt.Errorf("expected an optional value to encrypt")
+	}
+
+	var value string
+	if len(positional) == 1 {
+		value = positional[0]
+	} else {
+		value, err = c.readValue("Value to encrypt: ", true)
+		if err != nil {
+			return err
+		}
+	}
+
+	var section, key string
+	if *node != "" {
+		section, key, err = splitNodePath(*node)
+		if err != nil {
+			return err
+		}
+	}
+
+	config, err := c.newConfig(flags)
+	if err != nil {
+		return err
+	}
+
+	ciphertext, err := config.EncryptValue(section, key, value, *keyID)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(c.stdout, ciphertext)
+	return err
+}
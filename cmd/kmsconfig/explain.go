@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+)
+
+func (c *cli) explain(args []string) error {
+	var flags configFlags
+	flagSet := c.flagSet("explain", &flags)
+
+	positional, err := parseArgs(flagSet, args)
+	if err != nil {
+		return err
+	}
+
+	if len(positional) != 1 {
+		return fmt.Errorf("expected a single node argument, e.g. 'app.timeout'")
+	}
+
+	section, key, err := splitNodePath(positional[0])
+	if err != nil {
+		return err
+	}
+
+	config, err := c.newConfig(flags)
+	if err != nil {
+		return err
+	}
+
+	_, err = config.Load()
+	if err != nil {
+		return err
+	}
+
+	explanation, err := config.Explain(section, key)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprint(c.stdout, explanation)
+	return err
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/vidsy/go-kmsconfig/v6/kmsconfig"
+)
+
+func (c *cli) gen(args []string) error {
+	var flags configFlags
+	flagSet := c.flagSet("gen", &flags)
+	packageName := flagSet.String("package", "config", "package name for the generated file")
+	typeName := flagSet.String("type", "Config", "name of the generated root struct")
+	out := flagSet.String("out", "", "file to write the generated source to, defaults to stdout")
+
+	positional, err := parseArgs(flagSet, args)
+	if err != nil {
+		return err
+	}
+
+	if len(positional) != 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(positional, " "))
+	}
+
+	config, err := c.newConfig(flags)
+	if err != nil {
+		return err
+	}
+
+	err = config.Read()
+	if err != nil {
+		return err
+	}
+
+	source, err := kmsconfig.GenerateStruct(config, *packageName, *typeName)
+	if err != nil {
+		return err
+	}
+
+	if *out != "" {
+		return os.WriteFile(*out, source, 0644)
+	}
+
+	_, err = c.stdout.Write(source)
+	return err
+}
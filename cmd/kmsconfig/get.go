@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+func (c *cli) get(args []string) error {
+	var flags configFlags
+	flagSet := c.flagSet("get", &flags)
+	decrypt := flagSet.Bool("decrypt", false, "decrypt the value if the node is secure")
+
+	positional, err := parseArgs(flagSet, args)
+	if err != nil {
+		return err
+	}
+
+	if len(positional) != 1 {
+		return fmt.Errorf("expected a single node argument, e.g. 'app.db_password'")
+	}
+
+	section, key, err := splitNodePath(positional[0])
+	if err != nil {
+		return err
+	}
+
+	config, err := c.newConfig(flags)
+	if err != nil {
+		return err
+	}
+
+	err = config.Read()
+	if err != nil {
+		return err
+	}
+
+	value, secure, err := config.StoredValue(section, key)
+	if err != nil {
+		return err
+	}
+
+	if secure && *decrypt {
+		value, err = config.DecryptStoredValue(section, key)
+		if err != nil {
+			return fmt.Errorf("error decrypting secure value for node %s.%s: %s", section, key, err)
+		}
+	}
+
+	if stringValue, ok := value.(string); ok {
+		_, err = fmt.Fprintln(c.stdout, stringValue)
+		return err
+	}
+
+	encodedValue, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(c.stdout, string(encodedValue))
+	return err
+}
@@ -0,0 +1,220 @@
+// Command kmsconfig reads and edits go-kmsconfig environment files, using
+// the same Config and KMSWrapper code paths as the services consuming them.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vidsy/go-kmsconfig/v6/kmsconfig"
+)
+
+const usage = `Usage: kmsconfig <command> [flags] [arguments]
+
+Commands:
+  diff      List nodes that differ between two environments
+  encrypt   Print the ciphertext of a value, for pasting into an environment file
+  edit      Decrypt the environment file into $EDITOR and re-encrypt changes
+  explain   Show where the value of a node came from, without secrets
+  gen       Generate a Go struct for Populate from an environment file
+  get       Print the value of a node
+  rotate    Re-encrypt every secure node under a new KMS key
+  schema    Print the JSON Schema for the environment file format
+  set       Set the value of a node, encrypting it when --secure is given
+  unset     Remove a node
+  validate  Check every node has a value and every secure value decrypts
+
+Run 'kmsconfig <command> -h' for the flags accepted by a command.
+`
+
+type (
+	cli struct {
+		stdin      io.Reader
+		stdout     io.Writer
+		stderr     io.Writer
+		kmsWrapper *kmsconfig.KMSWrapper
+	}
+
+	command func(c *cli, args []string) error
+
+	configFlags struct {
+		path              string
+		env               string
+		keyFile           string
+		encryptionContext string
+		envelope          bool
+		kms               kmsconfig.KMSOptions
+	}
+)
+
+var commands = map[string]command{
+	"diff":     (*cli).diff,
+	"edit":     (*cli).edit,
+	"encrypt":  (*cli).encrypt,
+	"explain":  (*cli).explain,
+	"gen":      (*cli).gen,
+	"get":      (*cli).get,
+	"rotate":   (*cli).rotate,
+	"schema":   (*cli).schema,
+	"set":      (*cli).set,
+	"unset":    (*cli).unset,
+	"validate": (*cli).validate,
+}
+
+func main() {
+	c := &cli{
+		stdin:  os.Stdin,
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+	}
+
+	os.Exit(c.run(os.Args[1:]))
+}
+
+func (c *cli) run(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(c.stderr, usage)
+		return 2
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(c.stderr, "Unknown command '%s'\n\n%s", args[0], usage)
+		return 2
+	}
+
+	err := cmd(c, args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+
+	if err != nil {
+		fmt.Fprintf(c.stderr, "kmsconfig %s: %s\n", args[0], err)
+		return 1
+	}
+
+	return 0
+}
+
+func (c *cli) flagSet(name string, flags *configFlags) *flag.FlagSet {
+	flagSet := flag.NewFlagSet(name, flag.ContinueOnError)
+	flagSet.SetOutput(c.stderr)
+	flagSet.StringVar(&flags.path, "path", "./config", "folder containing the environment files")
+	flagSet.StringVar(&flags.env, "env", "", "environment to use, defaults to $AWS_ENV or development")
+	flagSet.StringVar(&flags.encryptionContext, "encryption-context", os.Getenv("KMSCONFIG_ENCRYPTION_CONTEXT"), "KMS encryption context as comma separated key=value pairs, e.g. 'env=${env},node=${node}', defaults to $KMSCONFIG_ENCRYPTION_CONTEXT")
+	flagSet.BoolVar(&flags.envelope, "envelope", false, "envelope encrypt every value with a KMS data key, not only those over the 4KB KMS limit")
+	flagSet.StringVar(&flags.keyFile, "key-file", os.Getenv("KMSCONFIG_KEY_FILE"), "AES-GCM or age key file to use instead of KMS, defaults to $KMSCONFIG_KEY_FILE")
+	flagSet.StringVar(&flags.kms.Region, "region", "", "AWS region of the KMS keys, defaults to the region of the AWS profile")
+	flagSet.StringVar(&flags.kms.Endpoint, "kms-endpoint", os.Getenv("KMSCONFIG_KMS_ENDPOINT"), "AWS endpoint to send KMS requests to, e.g. a local KMS stand-in, defaults to $KMSCONFIG_KMS_ENDPOINT")
+	flagSet.StringVar(&flags.kms.Profile, "profile", "", "AWS shared config profile, defaults to $AWS_PROFILE")
+	flagSet.StringVar(&flags.kms.RoleARN, "role-arn", "", "IAM role to assume before calling KMS")
+	flagSet.StringVar(&flags.kms.ExternalID, "external-id", "", "external ID to assume --role-arn with")
+	flagSet.Func("grant-token", "KMS grant token to send with requests, may be repeated", func(grantToken string) error {
+		flags.kms.GrantTokens = append(flags.kms.GrantTokens, grantToken)
+		return nil
+	})
+
+	return flagSet
+}
+
+func (c *cli) newConfig(flags configFlags) (*kmsconfig.Config, error) {
+	config := kmsconfig.NewConfig(flags.path, func(string) {})
+	if flags.env != "" {
+		config.Env = flags.env
+	}
+
+	if c.kmsWrapper != nil {
+		config.KMSWrapper = *c.kmsWrapper
+	} else if kmsOptionsSet(flags.kms) {
+		kmsWrapper, err := kmsconfig.NewKMSWrapperWithOptions(flags.kms)
+		if err != nil {
+			return nil, err
+		}
+
+		config.KMSWrapper = kmsWrapper
+	}
+	config.KMSWrapper.Envelope = flags.envelope
+
+	if flags.encryptionContext != "" {
+		config.EncryptionContext = make(map[string]string)
+		for _, pair := range strings.Split(flags.encryptionContext, ",") {
+			contextKey, contextValue, ok := strings.Cut(pair, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid --encryption-context pair '%s', expected key=value", pair)
+			}
+
+			config.EncryptionContext[strings.TrimSpace(contextKey)] = strings.TrimSpace(contextValue)
+		}
+	}
+
+	if flags.keyFile != "" {
+		keyFile, _ := filepath.Abs(flags.keyFile)
+		config.KeyFiles = map[string]string{config.Env: keyFile}
+	}
+
+	return config, nil
+}
+
+// kmsOptionsSet reports whether any KMS client flag was given, so the
+// default AWS config is used otherwise.
+func kmsOptionsSet(options kmsconfig.KMSOptions) bool {
+	return options.Region != "" ||
+		options.Endpoint != "" ||
+		options.Profile != "" ||
+		options.RoleARN != "" ||
+		len(options.GrantTokens) > 0
+}
+
+// environments lists the environments with a config file in path.
+func environments(path string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(path, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no environment files found in '%s'", path)
+	}
+
+	envs := make([]string, 0, len(files))
+	for _, file := range files {
+		envs = append(envs, strings.TrimSuffix(filepath.Base(file), ".json"))
+	}
+
+	return envs, nil
+}
+
+// parseArgs parses flags that appear either side of positional arguments,
+// so 'set app.key --secure' behaves the same as 'set --secure app.key'.
+func parseArgs(flagSet *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+
+	for {
+		err := flagSet.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+
+		args = flagSet.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func splitNodePath(nodePath string) (string, string, error) {
+	parts := strings.SplitN(nodePath, ".", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("expected node in the form 'section.key', got: '%s'", nodePath)
+	}
+
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vidsy/go-kmsconfig/v6/kmsconfig"
+)
+
+func (c *cli) rotate(args []string) error {
+	var flags configFlags
+	flagSet := c.flagSet("rotate", &flags)
+	flagSet.Lookup("env").Usage = "environment to rotate, or 'all' for every environment file in --path"
+	toKey := flagSet.String("to-key", "", "KMS key ID, alias or ARN to re-encrypt secure values under")
+
+	positional, err := parseArgs(flagSet, args)
+	if err != nil {
+		return err
+	}
+
+	if len(positional) != 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(positional, " "))
+	}
+
+	if *toKey == "" {
+		return fmt.Errorf("--to-key is required")
+	}
+
+	envs := []string{flags.env}
+	if flags.env == "all" {
+		envs, err = environments(flags.path)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Re-encrypt every environment before writing any of them, so a failure
+	// part way through doesn't leave files under a mix of keys.
+	configs := make([]*kmsconfig.Config, 0, len(envs))
+	touchedNodes := make([][]string, 0, len(envs))
+
+	for _, env := range envs {
+		envFlags := flags
+		envFlags.env = env
+
+		config, err := c.newConfig(envFlags)
+		if err != nil {
+			return err
+		}
+
+		err = config.Read()
+		if err != nil {
+			return err
+		}
+
+		nodes, err := config.Reencrypt(*toKey)
+		if err != nil {
+			return fmt.Errorf("%s: %s", config.Env, err)
+		}
+
+		configs = append(configs, config)
+		touchedNodes = append(touchedNodes, nodes)
+	}
+
+	for i, config := range configs {
+		err = config.Save()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(c.stdout, "%s: re-encrypted %d node(s) under %s\n", config.Env, len(touchedNodes[i]), *toKey)
+		for _, node := range touchedNodes[i] {
+			fmt.Fprintf(c.stdout, "  %s\n", node)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/vidsy/go-kmsconfig/v6/kmsconfig"
+)
+
+// schema prints the JSON Schema for the environment file format. Services
+// generate a schema for the nodes they expect with kmsconfig.Schema.
+func (c *cli) schema(args []string) error {
+	flagSet := flag.NewFlagSet("schema", flag.ContinueOnError)
+	flagSet.SetOutput(c.stderr)
+
+	positional, err := parseArgs(flagSet, args)
+	if err != nil {
+		return err
+	}
+
+	if len(positional) != 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(positional, " "))
+	}
+
+	_, err = c.stdout.Write(kmsconfig.FileSchema())
+	return err
+}
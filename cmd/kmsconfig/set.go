@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+func (c *cli) set(args []string) error {
+	var flags configFlags
+	flagSet := c.flagSet("set", &flags)
+	secure := flagSet.Bool("secure", false, "encrypt the value with KMS before storing it")
+	keyID := flagSet.String("key-id", os.Getenv("KMSCONFIG_KEY_ID"), "KMS key ID, alias or ARN used with --secure, defaults to $KMSCONFIG_KEY_ID")
+	forceString := flagSet.Bool("string", false, "store the value as a string instead of parsing it as JSON")
+
+	positional, err := parseArgs(flagSet, args)
+	if err != nil {
+		return err
+	}
+
+	if len(positional) < 1 || len(positional) > 2 {
+		return fmt.Errorf("expected a node argument and an optional value, e.g. 'app.db_password'")
+	}
+
+	section, key, err := splitNodePath(positional[0])
+	if err != nil {
+		return err
+	}
+
+	var value string
+	if len(positional) == 2 {
+		value = positional[1]
+	} else {
+		value, err = c.readValue(fmt.Sprintf("Value for %s: ", positional[0]), *secure)
+		if err != nil {
+			return err
+		}
+	}
+
+	config, err := c.newConfig(flags)
+	if err != nil {
+		return err
+	}
+
+	err = config.Read()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if *secure {
+		err = config.SetSecure(section, key, value, *keyID)
+	} else {
+		err = config.Set(section, key, parseValue(value, *forceString))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return config.Save()
+}
+
+// readValue prompts for a value on stderr and reads it from stdin. A
+// terminal is read up to the end of the line, without echoing it back when
+// the value is secret. Otherwise all of stdin is read, so multi-line values
+// such as PEM keys can be piped in, with trailing newlines trimmed.
+func (c *cli) readValue(prompt string, secret bool) (string, error) {
+	fmt.Fprint(c.stderr, prompt)
+
+	file, isFile := c.stdin.(*os.File)
+	terminal := isFile && term.IsTerminal(int(file.Fd()))
+
+	if terminal && secret {
+		value, err := term.ReadPassword(int(file.Fd()))
+		fmt.Fprintln(c.stderr)
+		return string(value), err
+	}
+
+	var value string
+	if terminal {
+		line, err := bufio.NewReader(c.stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+
+		value = line
+	} else {
+		contents, err := io.ReadAll(c.stdin)
+		if err != nil {
+			return "", err
+		}
+
+		value = string(contents)
+	}
+
+	if value == "" {
+		return "", fmt.Errorf("no value provided")
+	}
+
+	return strings.TrimRight(value, "\r\n"), nil
+}
+
+// parseValue treats the value as JSON so numbers, booleans and arrays keep
+// their types in the config file, falling back to a plain string.
+func parseValue(value string, forceString bool) interface{} {
+	if forceString {
+		return value
+	}
+
+	var parsedValue interface{}
+	err := json.Unmarshal([]byte(value), &parsedValue)
+	if err != nil {
+		return value
+	}
+
+	return parsedValue
+}
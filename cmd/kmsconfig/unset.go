@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+)
+
+func (c *cli) unset(args []string) error {
+	var flags configFlags
+	flagSet := c.flagSet("unset", &flags)
+
+	positional, err := parseArgs(flagSet, args)
+	if err != nil {
+		return err
+	}
+
+	if len(positional) != 1 {
+		return fmt.Errorf("expected a single node argument, e.g. 'app.db_password'")
+	}
+
+	section, key, err := splitNodePath(positional[0])
+	if err != nil {
+		return err
+	}
+
+	config, err := c.newConfig(flags)
+	if err != nil {
+		return err
+	}
+
+	err = config.Read()
+	if err != nil {
+		return err
+	}
+
+	err = config.Unset(section, key)
+	if err != nil {
+		return err
+	}
+
+	return config.Save()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/vidsy/go-kmsconfig/v6/kmsconfig"
+)
+
+func (c *cli) validate(args []string) error {
+	var flags configFlags
+	flagSet := c.flagSet("validate", &flags)
+	flagSet.Lookup("env").Usage = "environment to validate, or 'all' for every environment file in --path"
+
+	positional, err := parseArgs(flagSet, args)
+	if err != nil {
+		return err
+	}
+
+	if len(positional) != 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(positional, " "))
+	}
+
+	envs := []string{flags.env}
+	if flags.env == "all" {
+		envs, err = environments(flags.path)
+		if err != nil {
+			return err
+		}
+	}
+
+	failed := 0
+	for _, env := range envs {
+		envFlags := flags
+		envFlags.env = env
+
+		config, err := c.newConfig(envFlags)
+		if err != nil {
+			return err
+		}
+
+		err = config.Validate()
+		var validationError *kmsconfig.ValidationError
+		if errors.As(err, &validationError) {
+			failed++
+			fmt.Fprintf(c.stdout, "%s: %d problem(s)\n", config.Env, len(validationError.Problems))
+			for _, problem := range validationError.Problems {
+				fmt.Fprintf(c.stdout, "  %s\n", problem)
+			}
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s: %s", config.Env, err)
+		}
+
+		fmt.Fprintf(c.stdout, "%s: OK\n", config.Env)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d environment(s) failed validation", failed)
+	}
+
+	return nil
+}
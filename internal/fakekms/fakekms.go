@@ -0,0 +1,88 @@
+// Package fakekms provides a fake KMS client for the tests of kmsconfig and
+// the kmsconfig CLI.
+package fakekms
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+
+	"github.com/vidsy/go-kmsconfig/v6/kmsconfig"
+)
+
+// KMS "encrypts" by prefixing the plaintext with the key ID, and any
+// encryption context after a "#", so tests can assert on ciphertexts
+// without talking to AWS. Decrypting with a different context fails, as it
+// does with KMS.
+type KMS struct{}
+
+// NewKMSWrapper returns a KMSWrapper backed by KMS.
+func NewKMSWrapper() kmsconfig.KMSWrapper {
+	return kmsconfig.KMSWrapper{Client: &KMS{}}
+}
+
+func (f *KMS) Encrypt(_ context.Context, input *kms.EncryptInput, _ ...func(*kms.Options)) (*kms.EncryptOutput, error) {
+	return &kms.EncryptOutput{
+		CiphertextBlob: []byte(aws.ToString(input.KeyId) + formatEncryptionContext(input.EncryptionContext) + "|" + string(input.Plaintext)),
+		KeyId:          input.KeyId,
+	}, nil
+}
+
+// GenerateDataKey returns a data key derived from the key ID, wrapped the
+// same way Encrypt wraps plaintext.
+func (f *KMS) GenerateDataKey(ctx context.Context, input *kms.GenerateDataKeyInput, _ ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error) {
+	dataKey := sha256.Sum256([]byte(aws.ToString(input.KeyId)))
+	output, err := f.Encrypt(ctx, &kms.EncryptInput{
+		EncryptionContext: input.EncryptionContext,
+		KeyId:             input.KeyId,
+		Plaintext:         dataKey[:],
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &kms.GenerateDataKeyOutput{
+		CiphertextBlob: output.CiphertextBlob,
+		KeyId:          input.KeyId,
+		Plaintext:      dataKey[:],
+	}, nil
+}
+
+func (f *KMS) Decrypt(_ context.Context, input *kms.DecryptInput, _ ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	parts := strings.SplitN(string(input.CiphertextBlob), "|", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid ciphertext")
+	}
+
+	keyID, _, _ := strings.Cut(parts[0], "#")
+	if parts[0] != keyID+formatEncryptionContext(input.EncryptionContext) {
+		return nil, &types.InvalidCiphertextException{Message: aws.String("encryption context doesn't match")}
+	}
+
+	return &kms.DecryptOutput{
+		KeyId:     aws.String(keyID),
+		Plaintext: []byte(parts[1]),
+	}, nil
+}
+
+// formatEncryptionContext formats an encryption context for a ciphertext,
+// sorted so the same context always gives the same ciphertext.
+func formatEncryptionContext(encryptionContext map[string]string) string {
+	if len(encryptionContext) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(encryptionContext))
+	for key, value := range encryptionContext {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+
+	return "#" + strings.Join(pairs, ",")
+}
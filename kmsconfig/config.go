@@ -1,10 +1,14 @@
 package kmsconfig
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"maps"
 	"os"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -17,36 +21,82 @@ const (
 	overrideEnvStructure       = "VIDSY_VAR_%s_%s"
 	configNodeName             = "config"
 	configDurationTypeNodeName = "config_duration_type"
+	configDefaultNodeName      = "config_default"
+	configSecureNodeName       = "config_secure"
+	configEnumNodeName         = "config_enum"
+	configMinNodeName          = "config_min"
+	configMaxNodeName          = "config_max"
 	configOmitField            = "-"
+	dotenvPath                 = ".env"
 )
 
+// Config loads and populates an environment's config. Getters read from the
+// current Snapshot, so they are safe to call while the config is reloaded
+// or edited. Its exported fields must not change once it's loaded, and a
+// Config not made by NewConfig must not be copied before its first use.
 type Config struct {
-	data       map[string]map[string]map[string]interface{}
-	logHandler LogHandler
-	Env        string
+	shared *configState
+	// DebugHashKey keys the HMAC of secrets served by DebugHandler and
+	// DebugVar, so that hashes can be compared across replicas and
+	// restarts. A random key is generated for each process when it's empty.
+	DebugHashKey []byte
+	// DecryptCacheTTL, when set, reuses the plaintext of secure values
+	// decrypted within the TTL instead of calling KMS again on reload.
+	DecryptCacheTTL time.Duration
+	// Decrypter, when set, decrypts secure values in place of KMSWrapper.
+	Decrypter Decrypter
+	// Decrypters registers decrypters by provider name, for secure values
+	// with a "provider:" prefix or provider field.
+	Decrypters map[string]Decrypter
+	// EncryptionContext binds KMS ciphertext to where it's used, expanding
+	// ${env}, ${section}, ${key} and ${node} for each node.
+	EncryptionContext map[string]string
+	// Env is the environment to load, from AWS_ENV or "development".
+	Env string
+	// KeyFiles maps environments to key files that decrypt their secure
+	// values offline.
+	KeyFiles map[string]string
+	// KMSWrapper decrypts and encrypts secure values unless Decrypter or a
+	// key file is set.
 	KMSWrapper KMSWrapper
-	Path       string
-	Sections   map[string]ConfigSection
+	// Logger receives structured log records, discarding them when nil.
+	Logger *slog.Logger
+	// Observer is told about loads, decryptions and reloads.
+	Observer Observer
+	// Path is the folder holding the <env>.json files.
+	Path string
+	// SecretsManagerClient fetches secretsmanager:// references, defaulting
+	// to a client for the default AWS config when nil.
+	SecretsManagerClient SecretsManagerAPI
+	// SSMClient fetches ssm references, defaulting to a client for the
+	// default AWS config when nil.
+	SSMClient SSMAPI
+	// UnknownNodes is what Populate does with nodes no struct field maps
+	// to, ignoring them by default.
+	UnknownNodes UnknownNodePolicy
+	// VaultClient fetches vault:// references.
+	VaultClient *VaultClient
+	// WatchInterval is how often Watch polls for changes, defaulting to 10
+	// seconds.
+	WatchInterval time.Duration
 }
 
+// NewConfig creates a config for the environment files in path, logging
+// through logHandler. Set Logger to log structured records instead.
 func NewConfig(path string, logHandler LogHandler) *Config {
 	env := environment()
 
 	return &Config{
 		Env:        env,
 		KMSWrapper: NewKMSWrapper(),
-		logHandler: logHandler,
+		Logger:     slog.New(logHandler.Handler()),
+		shared:     &configState{},
 		Path:       path,
 	}
 }
 
 func (c Config) Boolean(node string, key string) (bool, error) {
-	configNode, err := c.retrieve(node, key, false)
-	if err != nil {
-		return false, err
-	}
-
-	return configNode.(bool), nil
+	return c.Snapshot().Boolean(node, key)
 }
 
 func (c Config) Environment() string {
@@ -54,70 +104,111 @@ func (c Config) Environment() string {
 }
 
 func (c Config) Integer(node string, key string) (int, error) {
-	configNode, err := c.retrieve(node, key, false)
+	return c.Snapshot().Integer(node, key)
+}
+
+// Load reads and decrypts the environment file, falling back to
+// environment variables when there isn't one, and swaps in the Snapshot it
+// returns. The config is left unchanged if loading fails.
+func (c *Config) Load() (*Snapshot, error) {
+	return c.LoadContext(context.Background())
+}
+
+// LoadContext loads the config like Load, passing ctx to the KMS, SSM and
+// Secrets Manager calls it makes and to decrypters that are
+// ContextDecrypters.
+func (c *Config) LoadContext(ctx context.Context) (*Snapshot, error) {
+	state := c.state()
+	snapshot, err := c.load(ctx)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	value := configNode.(float64)
-	return int(value), nil
+	state.swap(snapshot)
+	return snapshot, nil
 }
 
-func (c *Config) Load() error {
-
-	config, err := os.ReadFile(c.generatePath())
-	if errors.Is(err, os.ErrNotExist) {
-		return c.parseEnvsWithoutEncryption()
-	}
+func (c *Config) LoadAndPopulate(config interface{}) error {
+	return c.LoadAndPopulateContext(context.Background(), config)
+}
 
+// LoadAndPopulateContext loads and populates the config like
+// LoadAndPopulate, passing ctx on as LoadContext does.
+func (c *Config) LoadAndPopulateContext(ctx context.Context, config interface{}) error {
+	fromEnvironment := os.Getenv("VIDSY_VAR_CONFIG_EXCLUSIVELY_FROM_ENVIRONMENT") == "true"
+	err := c.loadAndPopulate(ctx, config, fromEnvironment)
 	if err != nil {
 		return err
 	}
 
-	err = json.Unmarshal([]byte(config), &c.data)
+	c.state().rememberPopulated(reflect.TypeOf(config).Elem(), fromEnvironment)
+	return nil
+}
+
+func (c *Config) loadAndPopulate(ctx context.Context, config interface{}, fromEnvironment bool) error {
+	if !fromEnvironment {
+		_, err := c.LoadContext(ctx)
+		if err != nil {
+			return err
+		}
+		return c.Populate(config)
+	}
+
+	snapshot, unmatchedEnvVars, err := c.loadEnvironment(ctx, config)
 	if err != nil {
 		return err
 	}
 
-	return c.parse()
+	c.state().swap(snapshot)
+	return c.reportUnmappedNodes("environment variable", unmatchedEnvVars)
 }
 
-func (c *Config) LoadAndPopulate(config interface{}) error {
-	if os.Getenv("VIDSY_VAR_CONFIG_EXCLUSIVELY_FROM_ENVIRONMENT") == "true" {
-		return loadEnvConfig(config, c.KMSWrapper)
+func (c Config) Populate(config interface{}) error {
+	errs := c.populate(config, true)
+	if len(errs) > 0 {
+		return errs[0]
 	}
 
-	err := c.Load()
-	if err != nil {
-		return err
+	if c.UnknownNodes == UnknownNodesIgnore {
+		return nil
 	}
-	return c.Populate(config)
+
+	return c.reportUnmappedNodes("config node", c.unmappedNodes(reflect.TypeOf(config).Elem()))
 }
 
-func (c Config) Populate(config interface{}) error {
+// populate sets the fields of config from the loaded sections. When
+// failFast is false every field is attempted and all errors are returned.
+func (c Config) populate(config interface{}, failFast bool) []error {
 	configPointer := reflect.ValueOf(config)
 	if configPointer.Kind() != reflect.Ptr {
-		return errors.New("Struct must be passed by reference")
+		return []error{errors.New("Struct must be passed by reference")}
 	}
 
 	configValue := configPointer.Elem()
 	if configValue.NumField() == 0 {
-		return errors.New("Expected struct to have >= 1 field, got 0")
+		return []error{errors.New("Expected struct to have >= 1 field, got 0")}
 	}
 
+	var errs []error
+
 	for i := 0; i < configValue.NumField(); i++ {
 		nodeFieldValue := configValue.Field(i)
 		nodeFieldType := configValue.Type().Field(i)
 		if nodeFieldValue.Kind() == reflect.Map {
 			continue
 		}
-		if nodeFieldValue.NumField() == 0 {
-			return errors.Errorf(
+		if nodeFieldValue.Kind() != reflect.Struct || nodeFieldValue.NumField() == 0 {
+			errs = append(errs, errors.Errorf(
 				"Struct '%s' should have 1 or more fields representing the second level of nesting in the config file, found no fields",
 				nodeFieldType.Name,
-			)
+			))
+			if failFast {
+				return errs
+			}
+			continue
 		}
 
+		sectionErrs := len(errs)
 		for j := 0; j < nodeFieldValue.NumField(); j++ {
 			sectionFieldType := nodeFieldValue.Type().Field(j)
 			sectionFieldValue := nodeFieldValue.Field(j)
@@ -127,150 +218,219 @@ func (c Config) Populate(config interface{}) error {
 				continue
 			}
 
-			nodeData, err := c.retrieve(nodeTag, sectionTag, false)
+			err := c.populateField(nodeTag, sectionTag, sectionFieldType, sectionFieldValue)
 			if err != nil {
-				return errors.Wrapf(
-					err,
-					"Unabled to find config value for %s.%s",
-					nodeTag,
-					sectionTag,
-				)
-			}
-
-			switch sectionFieldValue.Kind() {
-			case reflect.Int64:
-				var intType int64
-				convertedValue := reflect.ValueOf(nodeData).Convert(reflect.TypeOf(intType))
-
-				switch sectionFieldValue.Type().Name() {
-				case "Duration":
-					var duration time.Duration
-					durationValue := convertedValue.Int()
-
-					configDurationTypeTag := sectionFieldType.Tag.Get(configDurationTypeNodeName)
-					switch configDurationTypeTag {
-					case "microseconds":
-						duration = time.Microsecond * time.Duration(durationValue)
-					case "milliseconds":
-						duration = time.Millisecond * time.Duration(durationValue)
-					case "seconds":
-						duration = time.Second * time.Duration(durationValue)
-					case "minutes":
-						duration = time.Minute * time.Duration(durationValue)
-					case "hours":
-						duration = time.Hour * time.Duration(durationValue)
-					case "days":
-						duration = (time.Hour * 24) * time.Duration(durationValue)
-					default:
-						return errors.Errorf(
-							"Expected field of type time.Duration to have a struct tag '%s'",
-							configDurationTypeNodeName,
-						)
-					}
-
-					sectionFieldValue.Set(reflect.ValueOf(duration))
-				default:
-					sectionFieldValue.Set(convertedValue)
-				}
-			case reflect.Slice:
-				slice, err := c.StringSlice(nodeTag, sectionTag)
-				if err != nil {
-					return err
+				errs = append(errs, err)
+				if failFast {
+					return errs
 				}
+			}
+		}
 
-				sectionFieldValue.Set(reflect.ValueOf(slice))
-			default:
-				nodeDataValue := reflect.ValueOf(nodeData)
-				if sectionFieldValue.Kind() != nodeDataValue.Kind() {
-					return errors.Errorf(
-						"Expected data type in field '%s' to be the same as the type in the config node, got: %s != %s",
-						sectionFieldType.Name,
-						sectionFieldValue.Kind(),
-						nodeDataValue.Kind(),
-					)
+		builder, isBuilder := nodeFieldValue.Addr().Interface().(sectionBuilder)
+		if isBuilder && len(errs) == sectionErrs {
+			err := builder.build(nodeFieldType.Tag.Get(configNodeName))
+			if err != nil {
+				errs = append(errs, err)
+				if failFast {
+					return errs
 				}
-
-				sectionFieldValue.Set(reflect.ValueOf(nodeData))
 			}
 		}
 	}
 
-	return nil
+	return errs
 }
 
-func (c Config) String(node string, key string) (string, error) {
-	configNode, err := c.retrieve(node, key, false)
+func (c Config) populateField(nodeTag string, sectionTag string, sectionFieldType reflect.StructField, sectionFieldValue reflect.Value) error {
+	configNode, err := c.retrieveNode(nodeTag, sectionTag)
 	if err != nil {
-		return "", err
+		defaultValue, hasDefault := sectionFieldType.Tag.Lookup(configDefaultNodeName)
+		if !hasDefault {
+			return errors.Wrapf(
+				err,
+				"Unabled to find config value for %s.%s",
+				nodeTag,
+				sectionTag,
+			)
+		}
+
+		configNode.Value, err = defaultNodeData(sectionFieldValue.Type(), defaultValue)
+		if err != nil {
+			return errors.Wrapf(err, "Invalid '%s' tag on field '%s'", configDefaultNodeName, sectionFieldType.Name)
+		}
+
+		configNode.Name = sectionTag
+		configNode.Sources = []Source{{SourceDefault, sectionFieldType.Name}}
+		if c.shared != nil {
+			c.shared.recordDefault(nodeTag, configNode)
+		}
 	}
 
-	return configNode.(string), nil
-}
+	nodeData := configNode.Value
+	if nodeData == nil {
+		return errors.Errorf("Config node %s.%s has no value", nodeTag, sectionTag)
+	}
 
-func (c Config) StringSlice(node string, key string) ([]string, error) {
-	configNode, err := c.retrieve(node, key, false)
+	if sectionFieldType.Tag.Get(configSecureNodeName) == "true" && !configNode.Secure {
+		return errors.Errorf("Config node %s.%s must be secure", nodeTag, sectionTag)
+	}
+
+	err = checkConstraints(sectionFieldType, nodeData)
 	if err != nil {
-		return nil, err
+		return errors.Wrapf(err, "Invalid config value for %s.%s", nodeTag, sectionTag)
 	}
 
-	var values []string
-	switch reflect.TypeOf(configNode).Kind() {
+	return assignNodeValue(nodeTag, sectionTag, sectionFieldType, sectionFieldValue, configNode)
+}
+
+// assignNodeValue converts the value of a config node, in the shape it has
+// when read from a JSON config file, to the type of a struct field and sets
+// the field to it.
+func assignNodeValue(nodeTag string, sectionTag string, sectionFieldType reflect.StructField, sectionFieldValue reflect.Value, configNode ConfigNode) error {
+	nodeData := configNode.Value
+	if sectionFieldValue.Type() == certPoolType {
+		pool, err := newCertPool(nodeData)
+		if err != nil {
+			return errors.Wrapf(err, "Invalid config value for %s.%s", nodeTag, sectionTag)
+		}
+
+		sectionFieldValue.Set(reflect.ValueOf(pool))
+		return nil
+	}
+
+	switch sectionFieldValue.Kind() {
+	case reflect.Int64:
+		var intType int64
+		nodeDataValue := reflect.ValueOf(nodeData)
+		if nodeDataValue.Kind() != reflect.Float64 {
+			return errors.Errorf(
+				"Expected data type in field '%s' to be a number in the config node, got: %s",
+				sectionFieldType.Name,
+				nodeDataValue.Kind(),
+			)
+		}
+
+		convertedValue := nodeDataValue.Convert(reflect.TypeOf(intType))
+
+		switch sectionFieldValue.Type().Name() {
+		case "Duration":
+			var duration time.Duration
+			durationValue := convertedValue.Int()
+
+			configDurationTypeTag := sectionFieldType.Tag.Get(configDurationTypeNodeName)
+			switch configDurationTypeTag {
+			case "microseconds":
+				duration = time.Microsecond * time.Duration(durationValue)
+			case "milliseconds":
+				duration = time.Millisecond * time.Duration(durationValue)
+			case "seconds":
+				duration = time.Second * time.Duration(durationValue)
+			case "minutes":
+				duration = time.Minute * time.Duration(durationValue)
+			case "hours":
+				duration = time.Hour * time.Duration(durationValue)
+			case "days":
+				duration = (time.Hour * 24) * time.Duration(durationValue)
+			default:
+				return errors.Errorf(
+					"Expected field of type time.Duration to have a struct tag '%s'",
+					configDurationTypeNodeName,
+				)
+			}
+
+			sectionFieldValue.Set(reflect.ValueOf(duration))
+		default:
+			sectionFieldValue.Set(convertedValue)
+		}
 	case reflect.Slice:
-		configNodeReflectedValue := reflect.ValueOf(configNode)
-		for i := 0; i < configNodeReflectedValue.Len(); i++ {
-			item := configNodeReflectedValue.Index(i).Elem()
-			if item.Kind() != reflect.String {
-				return nil, fmt.Errorf(
-					"Mixed types in slice, expected all strings but got: %s",
-					item.Kind(),
+		if sectionFieldValue.Type().Elem().Kind() == reflect.Uint8 {
+			data, err := byteSlice(configNode)
+			if err != nil {
+				return errors.Wrapf(err, "Invalid config value for %s.%s", nodeTag, sectionTag)
+			}
+
+			sectionFieldValue.SetBytes(data)
+			break
+		}
+
+		if sectionFieldValue.Type().Elem().Kind() == reflect.Interface {
+			values, isSlice := nodeData.([]interface{})
+			if !isSlice {
+				return errors.Errorf(
+					"Expected data type in field '%s' to be an array in the config node, got: %s",
+					sectionFieldType.Name,
+					reflect.ValueOf(nodeData).Kind(),
 				)
 			}
 
-			values = append(
-				values,
-				item.String(),
-			)
+			sectionFieldValue.Set(reflect.ValueOf(slices.Clone(values)))
+			break
 		}
+
+		slice, err := stringSlice(nodeData)
+		if err != nil {
+			return err
+		}
+
+		sectionFieldValue.Set(reflect.ValueOf(slice))
 	default:
-		return nil, fmt.Errorf(
-			"Expected underlying type to be a Slice, got: %s",
-			reflect.TypeOf(configNode).Kind(),
-		)
-	}
+		nodeDataValue := reflect.ValueOf(nodeData)
+		if sectionFieldValue.Kind() != nodeDataValue.Kind() {
+			return errors.Errorf(
+				"Expected data type in field '%s' to be the same as the type in the config node, got: %s != %s",
+				sectionFieldType.Name,
+				sectionFieldValue.Kind(),
+				nodeDataValue.Kind(),
+			)
+		}
 
-	return values, nil
-}
+		if !nodeDataValue.Type().ConvertibleTo(sectionFieldValue.Type()) {
+			return errors.Errorf(
+				"Expected data type in field '%s' to be convertible from the type in the config node, got: %s != %s",
+				sectionFieldType.Name,
+				sectionFieldValue.Type(),
+				nodeDataValue.Type(),
+			)
+		}
 
-func (c Config) EncryptedString(node string, key string) (string, error) {
-	configNode, err := c.retrieve(node, key, true)
-	if err != nil {
-		return "", err
+		sectionFieldValue.Set(nodeDataValue.Convert(sectionFieldValue.Type()))
 	}
 
-	return configNode.(string), nil
+	return nil
 }
 
-func (c Config) RawValue(node string, key string) (interface{}, error) {
-	configNode, err := c.retrieve(node, key, false)
+// Read loads the environment file as it is stored on disk, without applying
+// overrides or decrypting secure values. It is used when editing a config
+// file rather than consuming it.
+func (c *Config) Read() error {
+	data, contents, err := c.readData()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return configNode, nil
+	return c.state().update(func(snapshot *Snapshot) error {
+		snapshot.env = c.Env
+		snapshot.data = data
+		snapshot.contents = contents
+		return nil
+	})
 }
 
-func (c Config) decryptSecureValue(key string, value string) (string, error) {
-	c.logHandler(
-		fmt.Sprintf("Encrypted config value found for '%s', decrypting", key),
-	)
+func (c Config) String(node string, key string) (string, error) {
+	return c.Snapshot().String(node, key)
+}
 
-	decryptedValue, err := c.KMSWrapper.Decrypt(value)
+func (c Config) StringSlice(node string, key string) ([]string, error) {
+	return c.Snapshot().StringSlice(node, key)
+}
 
-	if err != nil {
-		return "", err
-	}
+func (c Config) EncryptedString(node string, key string) (string, error) {
+	return c.Snapshot().EncryptedString(node, key)
+}
 
-	return decryptedValue, nil
+func (c Config) RawValue(node string, key string) (interface{}, error) {
+	return c.Snapshot().RawValue(node, key)
 }
 
 func (c Config) overrideEnv(sectionValue string, nodeValue string) (string, bool) {
@@ -278,8 +438,9 @@ func (c Config) overrideEnv(sectionValue string, nodeValue string) (string, bool
 	exists := os.Getenv(environmentVariable)
 
 	if exists != "" {
-		c.logHandler(
-			fmt.Sprintf("Override variable '%s' found", environmentVariable),
+		c.logger().Info(
+			"Override variable found",
+			"section", sectionValue, "key", nodeValue, "source", SourceOverride, "variable", environmentVariable,
 		)
 		return exists, true
 	}
@@ -287,10 +448,91 @@ func (c Config) overrideEnv(sectionValue string, nodeValue string) (string, bool
 	return "", false
 }
 
-func (c *Config) parse() error {
-	c.Sections = make(map[string]ConfigSection)
+// load reads and parses the environment file, falling back to environment
+// variables when there isn't one, without modifying the config.
+func (c Config) load(ctx context.Context) (*Snapshot, error) {
+	start := time.Now()
+	c.forgetKeyFiles()
+	snapshot, err := c.parseFile(ctx)
+
+	decrypted, cacheHits := countDecrypted(snapshot.sections)
+	c.observer().ObserveLoad(ctx, LoadEvent{c.Env, time.Since(start), decrypted, cacheHits, err})
+
+	return snapshot, err
+}
+
+// loadEnvironment populates config from VIDSY_VAR_* variables alone,
+// returning a snapshot of the values it used and the variables no field of
+// config maps to, without modifying the config.
+func (c Config) loadEnvironment(ctx context.Context, config interface{}) (*Snapshot, []string, error) {
+	start := time.Now()
+	sections := make(map[string]ConfigSection)
+	unmatchedEnvVars, err := loadEnvConfig(ctx, config, c.decryptSecureValue, sections)
+
+	decrypted, cacheHits := countDecrypted(sections)
+	c.observer().ObserveLoad(ctx, LoadEvent{c.Env, time.Since(start), decrypted, cacheHits, err})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &Snapshot{env: c.Env, sections: sections, loadedAt: time.Now()}, unmatchedEnvVars, nil
+}
+
+func (c Config) parseFile(ctx context.Context) (*Snapshot, error) {
+	snapshot := &Snapshot{env: c.Env, loadedAt: time.Now()}
+
+	data, contents, err := c.readData()
+	if errors.Is(err, os.ErrNotExist) {
+		snapshot.sections, err = c.parseEnvsWithoutEncryption()
+		return snapshot, err
+	}
+
+	if err != nil {
+		return snapshot, err
+	}
+
+	snapshot.data = data
+	snapshot.contents = contents
+
+	sections, errs := c.parseSections(ctx, data, true)
+	snapshot.sections = sections
+	if len(errs) > 0 {
+		return snapshot, errs[0]
+	}
+
+	return snapshot, nil
+}
+
+// readData reads the environment file, returning its values and its
+// contents as stored on disk.
+func (c Config) readData() (map[string]map[string]map[string]interface{}, []byte, error) {
+	contents, err := os.ReadFile(c.generatePath())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var data map[string]map[string]map[string]interface{}
+	err = json.Unmarshal(contents, &data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, contents, nil
+}
+
+// parseSections builds the sections from the raw config data. When failFast
+// is false every node is parsed and all errors are returned, with nodes that
+// failed keeping their raw value.
+func (c Config) parseSections(ctx context.Context, data map[string]map[string]map[string]interface{}, failFast bool) (map[string]ConfigSection, []error) {
+	sections := make(map[string]ConfigSection)
+	var errs []error
+
+	references, err := c.fetchReferences(ctx, data)
+	if err != nil {
+		return sections, []error{err}
+	}
 
-	for sectionKey, sectionValue := range c.data {
+	for sectionKey, sectionValue := range data {
 		configNodes := make(map[string]ConfigNode)
 
 		section := ConfigSection{
@@ -299,77 +541,138 @@ func (c *Config) parse() error {
 		}
 
 		for nodeKey, nodeValue := range sectionValue {
-			secure, _ := nodeValue["secure"].(bool)
-			value := nodeValue["value"]
-			encryptedValue := ""
-
-			overrideEnvValue, envVarExists := c.overrideEnv(sectionKey, nodeKey)
-			if envVarExists {
-				switch value.(type) {
-				case string:
-					value = overrideEnvValue
-				case bool:
-					boolValue, err := strconv.ParseBool(overrideEnvValue)
-					if err != nil {
-						return fmt.Errorf("error parsing env var override boolean value: %s for node %s.%s", err.Error(), sectionKey, nodeKey)
-					}
-					value = boolValue
-				default:
-					var jsonValue interface{}
-					err := json.Unmarshal([]byte(overrideEnvValue), &jsonValue)
-					if err != nil {
-						return fmt.Errorf("error parsing env var override JSON value: %s for node %s.%s", err.Error(), sectionKey, nodeKey)
-					}
-					value = jsonValue
-				}
-			}
-
-			if secure {
-				encryptedStringValue, isString := value.(string)
-				if !isString {
-					return fmt.Errorf("secure value must be a string for node %s.%s", sectionKey, nodeKey)
-				}
-				decryptedValue, err := c.decryptSecureValue(nodeKey, encryptedStringValue)
-				if err != nil {
-					return fmt.Errorf("error decrypting secure value for node %s.%s: %s", sectionKey, nodeKey, err.Error())
+			node, err := c.parseNode(ctx, sectionKey, nodeKey, nodeValue, references)
+			if err != nil {
+				errs = append(errs, err)
+				if failFast {
+					return sections, errs
 				}
-				encryptedValue = encryptedStringValue
-				value = decryptedValue
-			}
-
-			node := ConfigNode{
-				nodeKey,
-				value,
-				encryptedValue,
-				secure,
 			}
 
 			configNodes[nodeKey] = node
 		}
 
-		c.Sections[sectionKey] = section
+		sections[sectionKey] = section
 	}
 
-	return nil
+	return sections, errs
 }
 
-func (c Config) retrieve(node string, key string, encryptedValue bool) (interface{}, error) {
-	section, sectionExists := c.Sections[node]
+func (c Config) parseNode(ctx context.Context, sectionKey string, nodeKey string, nodeValue map[string]interface{}, references references) (ConfigNode, error) {
+	secure, _ := nodeValue["secure"].(bool)
+	value := nodeValue["value"]
 
-	if sectionExists {
-		node, nodeExists := section.Nodes[key]
+	node := ConfigNode{
+		Name:    nodeKey,
+		Value:   value,
+		Secure:  secure,
+		Sources: []Source{{SourceFile, c.generatePath()}},
+	}
+
+	overrideEnvValue, envVarExists := c.overrideEnv(sectionKey, nodeKey)
+	if envVarExists {
+		node.Sources = append(node.Sources, Source{SourceOverride, fmt.Sprintf(overrideEnvStructure, sectionKey, nodeKey)})
+
+		// Parameters are strings, so overrides of SSM nodes are too.
+		if _, isSSMNode := nodeValue[ssmFieldName]; isSSMNode {
+			value = ""
+		}
 
-		if nodeExists {
-			if encryptedValue {
-				return node.EncryptedValue, nil
+		switch value.(type) {
+		case string:
+			value = overrideEnvValue
+		case bool:
+			boolValue, err := strconv.ParseBool(overrideEnvValue)
+			if err != nil {
+				return node, fmt.Errorf("error parsing env var override boolean value: %s for node %s.%s", err.Error(), sectionKey, nodeKey)
+			}
+			value = boolValue
+		default:
+			var jsonValue interface{}
+			err := json.Unmarshal([]byte(overrideEnvValue), &jsonValue)
+			if err != nil {
+				return node, fmt.Errorf("error parsing env var override JSON value: %s for node %s.%s", err.Error(), sectionKey, nodeKey)
 			}
-			return node.Value, nil
+			value = jsonValue
+		}
+	}
+
+	if name, isReference := ssmReference(nodeValue, value, envVarExists); isReference {
+		err := resolveSSMReference(&node, name, references.parameters)
+		if err != nil {
+			return node, fmt.Errorf("%s for node %s.%s", err.Error(), sectionKey, nodeKey)
+		}
+
+		return node, nil
+	}
+
+	if reference, isReference := parseSecretReference(value); isReference {
+		err := resolveSecretReference(&node, reference, references.secrets)
+		if err != nil {
+			return node, fmt.Errorf("%s for node %s.%s", err.Error(), sectionKey, nodeKey)
+		}
+
+		return node, nil
+	}
+
+	if reference, isReference := parseVaultReference(value); isReference {
+		err := resolveVaultReference(&node, reference, references.vaultSecrets)
+		if err != nil {
+			return node, fmt.Errorf("%s for node %s.%s", err.Error(), sectionKey, nodeKey)
+		}
+
+		return node, nil
+	}
+
+	if secure {
+		encryptedStringValue, isString := value.(string)
+		if !isString {
+			return node, fmt.Errorf("secure value must be a string for node %s.%s", sectionKey, nodeKey)
 		}
+		decryptedValue, source, err := c.decryptSecureNode(ctx, sectionKey, nodeKey, nodeValue, encryptedStringValue)
+		if err != nil {
+			return node, fmt.Errorf("error decrypting secure value for node %s.%s: %s", sectionKey, nodeKey, err.Error())
+		}
+		node.EncryptedValue = encryptedStringValue
+		node.Sources = append(node.Sources, source)
+		value = decryptedValue
+	}
+
+	node.Value = value
+	return node, nil
+}
+
+func (c Config) retrieveNode(node string, key string) (ConfigNode, error) {
+	return c.Snapshot().retrieveNode(node, key)
+}
+
+func stringSlice(configNode interface{}) ([]string, error) {
+	var values []string
+	switch reflect.TypeOf(configNode).Kind() {
+	case reflect.Slice:
+		configNodeReflectedValue := reflect.ValueOf(configNode)
+		for i := 0; i < configNodeReflectedValue.Len(); i++ {
+			item := configNodeReflectedValue.Index(i).Elem()
+			if item.Kind() != reflect.String {
+				return nil, fmt.Errorf(
+					"Mixed types in slice, expected all strings but got: %s",
+					item.Kind(),
+				)
+			}
 
-		return nil, fmt.Errorf("'%s' key doesn't exists on node '%s'", key, node.Name)
+			values = append(
+				values,
+				item.String(),
+			)
+		}
+	default:
+		return nil, fmt.Errorf(
+			"Expected underlying type to be a Slice, got: %s",
+			reflect.TypeOf(configNode).Kind(),
+		)
 	}
 
-	return nil, fmt.Errorf("The config node '%s' doesn't exist", node)
+	return values, nil
 }
 
 func environment() string {
@@ -386,12 +689,12 @@ func (c Config) generatePath() string {
 	return fmt.Sprintf("%s/%s.json", c.Path, c.Env)
 }
 
-func (c *Config) parseEnvsWithoutEncryption() error {
-	c.Sections = make(map[string]ConfigSection)
+func (c Config) parseEnvsWithoutEncryption() (map[string]ConfigSection, error) {
+	sections := make(map[string]ConfigSection)
 
-	err := godotenv.Load(".env")
-	if err != nil && !errors.Is(err, os.ErrNotExist) {
-		return err
+	dotenvVariables, err := c.state().loadDotenv(dotenvPath)
+	if err != nil {
+		return nil, err
 	}
 
 	for _, env := range os.Environ() {
@@ -399,6 +702,12 @@ func (c *Config) parseEnvsWithoutEncryption() error {
 			continue
 		}
 
+		envVarName := strings.SplitN(env, "=", 2)[0]
+		source := Source{SourceEnvironment, envVarName}
+		if dotenvVariables[envVarName] {
+			source = Source{SourceDotenv, dotenvPath + ":" + envVarName}
+		}
+
 		partsA := strings.SplitN(strings.ToLower(strings.TrimPrefix(env, "VIDSY_VAR_")), "_", 2)
 		if len(partsA) != 2 {
 			continue
@@ -417,7 +726,7 @@ func (c *Config) parseEnvsWithoutEncryption() error {
 			continue
 		}
 
-		section, ok := c.Sections[sectionName]
+		section, ok := sections[sectionName]
 		if !ok {
 			section = ConfigSection{
 				Name:  sectionName,
@@ -426,13 +735,61 @@ func (c *Config) parseEnvsWithoutEncryption() error {
 		}
 
 		section.Nodes[nodeName] = ConfigNode{
-			Name:   nodeName,
-			Value:  nodeValue,
-			Secure: false,
+			Name:    nodeName,
+			Value:   nodeValue,
+			Secure:  false,
+			Sources: []Source{source},
 		}
 
-		c.Sections[sectionName] = section
+		sections[sectionName] = section
 	}
 
-	return nil
+	return sections, nil
+}
+
+// loadDotenv sets any variables in the dotenv file that aren't already set
+// in the environment, returning the names of the variables set from it.
+// They're remembered, so that a later load updates the variables it set,
+// and unsets those removed from the file, while variables set in the
+// environment still take precedence.
+func (s *configState) loadDotenv(path string) (map[string]bool, error) {
+	values, err := godotenv.Read(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	s.dotenvMutex.Lock()
+	defer s.dotenvMutex.Unlock()
+
+	for name := range s.dotenvVariables {
+		if _, inFile := values[name]; inFile {
+			continue
+		}
+
+		err = os.Unsetenv(name)
+		if err != nil {
+			return nil, err
+		}
+
+		delete(s.dotenvVariables, name)
+	}
+
+	if s.dotenvVariables == nil {
+		s.dotenvVariables = make(map[string]bool)
+	}
+
+	for name, value := range values {
+		if _, isSet := os.LookupEnv(name); isSet && !s.dotenvVariables[name] {
+			continue
+		}
+
+		err = os.Setenv(name, value)
+		if err != nil {
+			return nil, err
+		}
+
+		s.dotenvVariables[name] = true
+	}
+
+	return maps.Clone(s.dotenvVariables), nil
 }
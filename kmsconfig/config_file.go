@@ -0,0 +1,512 @@
+package kmsconfig
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+)
+
+const (
+	valueFieldName  = "value"
+	secureFieldName = "secure"
+)
+
+type (
+	// editedSecret a secure value decrypted for editing, with what's needed
+	// to encrypt it again the same way: its provider prefix, and the KMS key
+	// it was under and whether it was envelope encrypted, or the encrypter
+	// of another provider.
+	editedSecret struct {
+		plaintext string
+		keyID     string
+		envelope  bool
+		encrypter Encrypter
+		prefix    string
+	}
+)
+
+// StoredValue returns the value of a node as it is stored in the environment
+// file, along with its secure flag. Secure values are returned encrypted.
+func (c Config) StoredValue(node string, key string) (interface{}, bool, error) {
+	nodeData, err := c.Snapshot().storedNode(node, key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	secure, _ := nodeData[secureFieldName].(bool)
+	return nodeData[valueFieldName], secure, nil
+}
+
+// Set stores a plain value for a node, creating the section and node if
+// they don't already exist. Any SSM reference, provider or encryption
+// context the node had is removed, as they don't apply to plain values.
+// Call Save to write the change to disk.
+func (c *Config) Set(node string, key string, value interface{}) error {
+	return c.updateData(func(data map[string]map[string]map[string]interface{}) error {
+		nodeData, err := editableNode(data, node, key)
+		if err != nil {
+			return err
+		}
+
+		nodeData[valueFieldName] = value
+		nodeData[secureFieldName] = false
+		delete(nodeData, ssmFieldName)
+		delete(nodeData, providerFieldName)
+		delete(nodeData, encryptionContextFieldName)
+
+		return nil
+	})
+}
+
+// DecryptStoredValue decrypts the stored value of a secure node with the
+// decrypter it's routed to.
+func (c Config) DecryptStoredValue(node string, key string) (string, error) {
+	nodeData, err := c.Snapshot().storedNode(node, key)
+	if err != nil {
+		return "", err
+	}
+
+	encryptedValue, isString := nodeData[valueFieldName].(string)
+	if secure, _ := nodeData[secureFieldName].(bool); !secure || !isString {
+		return "", fmt.Errorf("node %s.%s doesn't have a secure string value", node, key)
+	}
+
+	decrypter, ciphertext, _, err := c.routeNode(node, key, nodeData, encryptedValue)
+	if err != nil {
+		return "", err
+	}
+
+	return decrypter.Decrypt(ciphertext)
+}
+
+// EncryptValue encrypts the plaintext for a node the way the node is
+// decrypted: with the provider named by its provider field or by the prefix
+// on its current value, otherwise under the given KMS key with the node's
+// encryption context, or with the environment's key file or Decrypter if it
+// can encrypt. It returns the ciphertext with any provider prefix, ready to
+// store as a secure value.
+func (c Config) EncryptValue(node string, key string, plaintext string, keyID string) (string, error) {
+	nodeData, _ := c.Snapshot().storedNode(node, key)
+
+	var storedValue string
+	if secure, _ := nodeData[secureFieldName].(bool); secure {
+		storedValue, _ = nodeData[valueFieldName].(string)
+	}
+
+	encrypter, prefix, err := c.nodeEncrypter(node, key, nodeData, storedValue)
+	if err != nil {
+		return "", err
+	}
+
+	if _, isKMS := encrypter.(KMSWrapper); isKMS && keyID == "" {
+		return "", fmt.Errorf("a KMS key ID is required")
+	}
+
+	ciphertext, err := encrypter.Encrypt(keyID, plaintext)
+	if err != nil {
+		return "", err
+	}
+
+	return prefix + ciphertext, nil
+}
+
+// SetSecure encrypts the plaintext with EncryptValue and stores it as a
+// secure value for a node, removing any SSM reference the node had. The
+// node's provider and encryption context are kept, as the value is
+// encrypted with them. Call Save to write the change to disk.
+func (c *Config) SetSecure(node string, key string, plaintext string, keyID string) error {
+	encryptedValue, err := c.EncryptValue(node, key, plaintext, keyID)
+	if err != nil {
+		return fmt.Errorf("error encrypting secure value for node %s.%s: %s", node, key, err.Error())
+	}
+
+	return c.updateData(func(data map[string]map[string]map[string]interface{}) error {
+		nodeData, err := editableNode(data, node, key)
+		if err != nil {
+			return err
+		}
+
+		nodeData[valueFieldName] = encryptedValue
+		nodeData[secureFieldName] = true
+		delete(nodeData, ssmFieldName)
+
+		return nil
+	})
+}
+
+// encrypter returns the decrypter when it can also encrypt, such as a key
+// file, otherwise the KMSWrapper.
+func (c Config) encrypter() Encrypter {
+	if encrypter, ok := c.decrypter().(Encrypter); ok {
+		return encrypter
+	}
+
+	return c.KMSWrapper
+}
+
+// Unset removes a node, and its section if it was the last node in it.
+// Call Save to write the change to disk.
+func (c *Config) Unset(node string, key string) error {
+	return c.updateData(func(data map[string]map[string]map[string]interface{}) error {
+		if _, err := c.Snapshot().storedNode(node, key); err != nil {
+			return err
+		}
+
+		delete(data[node], key)
+		if len(data[node]) == 0 {
+			delete(data, node)
+		}
+
+		return nil
+	})
+}
+
+// Save writes the stored values back to the environment file, keeping the
+// order of the file as it was read. The file is written to a temporary file
+// first and renamed into place, so readers never see a partially written
+// config.
+func (c Config) Save() error {
+	snapshot := c.Snapshot()
+	contents, err := encodeFile(snapshot.contents, snapshot.data)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomically(c.generatePath(), contents)
+}
+
+// Edit decrypts every secure value into a plaintext copy of the environment
+// file and passes it to edit. The returned document replaces the stored
+// values: secure values whose plaintext, provider or encryption context
+// changed are encrypted under keyID, or the key they were previously
+// encrypted under if keyID is empty, while unchanged secure values keep
+// their original ciphertext. Values from other providers than KMS are
+// encrypted again by the same provider, unless the edit changed it. Call
+// Save to write the change to disk. The edit is made without holding up other
+// changes, and fails if the stored values changed while it was being made.
+func (c *Config) Edit(keyID string, edit func(plaintext []byte) ([]byte, error)) error {
+	state := c.state()
+	original := state.current()
+
+	editedData, err := c.edit(original.data, original.contents, keyID, edit)
+	if err != nil {
+		return err
+	}
+
+	return state.update(func(snapshot *Snapshot) error {
+		if !sameData(snapshot.data, original.data) {
+			return fmt.Errorf("config was changed while it was being edited")
+		}
+
+		snapshot.data = editedData
+		return nil
+	})
+}
+
+func (c Config) edit(data map[string]map[string]map[string]interface{}, contents []byte, keyID string, edit func(plaintext []byte) ([]byte, error)) (map[string]map[string]map[string]interface{}, error) {
+	plaintextData := make(map[string]map[string]map[string]interface{})
+	decryptedValues := make(map[string]editedSecret)
+
+	for sectionKey, sectionValue := range data {
+		plaintextData[sectionKey] = make(map[string]map[string]interface{})
+
+		for nodeKey, nodeValue := range sectionValue {
+			nodeData := make(map[string]interface{})
+			for field, value := range nodeValue {
+				nodeData[field] = value
+			}
+
+			if secure, _ := nodeValue[secureFieldName].(bool); secure && !isReference(nodeValue) {
+				encryptedValue, isString := nodeValue[valueFieldName].(string)
+				if !isString {
+					return nil, fmt.Errorf("secure value must be a string for node %s.%s", sectionKey, nodeKey)
+				}
+
+				decrypted, err := c.decryptForEdit(sectionKey, nodeKey, nodeValue, encryptedValue)
+				if err != nil {
+					return nil, fmt.Errorf("error decrypting secure value for node %s.%s: %s", sectionKey, nodeKey, err.Error())
+				}
+
+				decryptedValues[sectionKey+"."+nodeKey] = decrypted
+				nodeData[valueFieldName] = decrypted.plaintext
+			}
+
+			plaintextData[sectionKey][nodeKey] = nodeData
+		}
+	}
+
+	plaintextContents, err := encodeFile(contents, plaintextData)
+	if err != nil {
+		return nil, err
+	}
+
+	editedContents, err := edit(plaintextContents)
+	if err != nil {
+		return nil, err
+	}
+
+	var editedData map[string]map[string]map[string]interface{}
+	err = json.Unmarshal(editedContents, &editedData)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing edited config: %s", err.Error())
+	}
+
+	for sectionKey, sectionValue := range editedData {
+		for nodeKey, nodeValue := range sectionValue {
+			if secure, _ := nodeValue[secureFieldName].(bool); !secure || isReference(nodeValue) {
+				continue
+			}
+
+			plaintext, isString := nodeValue[valueFieldName].(string)
+			if !isString {
+				return nil, fmt.Errorf("secure value must be a string for node %s.%s", sectionKey, nodeKey)
+			}
+
+			original, wasSecure := decryptedValues[sectionKey+"."+nodeKey]
+			storedNode := data[sectionKey][nodeKey]
+			sameProvider := reflect.DeepEqual(nodeValue[providerFieldName], storedNode[providerFieldName])
+			sameContext := reflect.DeepEqual(nodeValue[encryptionContextFieldName], storedNode[encryptionContextFieldName])
+			if wasSecure && original.plaintext == plaintext && sameProvider && sameContext {
+				nodeValue[valueFieldName] = storedNode[valueFieldName]
+				continue
+			}
+
+			encrypter, prefix, encryptionKeyID := original.encrypter, original.prefix, ""
+			if !wasSecure || !sameProvider {
+				var err error
+				encrypter, prefix, err = c.nodeEncrypter(sectionKey, nodeKey, nodeValue, "")
+				if err != nil {
+					return nil, fmt.Errorf("error encrypting secure value for node %s.%s: %s", sectionKey, nodeKey, err.Error())
+				}
+			} else if encrypter == nil {
+				kmsWrapper := c.nodeKMSWrapper(c.KMSWrapper, sectionKey, nodeKey, nodeValue)
+				kmsWrapper.Envelope = kmsWrapper.Envelope || original.envelope
+				encrypter = kmsWrapper
+			}
+
+			if _, isKMS := encrypter.(KMSWrapper); isKMS {
+				encryptionKeyID = keyID
+				if encryptionKeyID == "" {
+					encryptionKeyID = original.keyID
+				}
+
+				if encryptionKeyID == "" {
+					return nil, fmt.Errorf("a KMS key ID is required to set secure value for node %s.%s", sectionKey, nodeKey)
+				}
+			}
+
+			encryptedValue, err := encrypter.Encrypt(encryptionKeyID, plaintext)
+			if err != nil {
+				return nil, fmt.Errorf("error encrypting secure value for node %s.%s: %s", sectionKey, nodeKey, err.Error())
+			}
+
+			nodeValue[valueFieldName] = prefix + encryptedValue
+		}
+	}
+
+	return editedData, nil
+}
+
+// decryptForEdit decrypts a stored secure value, keeping its provider
+// prefix, the KMS key ID and envelope format for KMS values, and the
+// encrypter for other providers.
+func (c Config) decryptForEdit(section string, key string, nodeValue map[string]interface{}, encryptedValue string) (editedSecret, error) {
+	decrypter, ciphertext, _, err := c.routeNode(section, key, nodeValue, encryptedValue)
+	if err != nil {
+		return editedSecret{}, err
+	}
+
+	prefix := encryptedValue[:len(encryptedValue)-len(ciphertext)]
+	if kmsWrapper, isKMS := decrypter.(KMSWrapper); isKMS {
+		plaintext, keyID, err := kmsWrapper.decryptWithKeyID(context.Background(), ciphertext)
+		return editedSecret{plaintext: plaintext, keyID: keyID, envelope: isEnvelope(ciphertext), prefix: prefix}, err
+	}
+
+	encrypter, ok := decrypter.(Encrypter)
+	if !ok {
+		return editedSecret{}, fmt.Errorf("decrypter %s can't encrypt edited values", decrypterLocation(decrypter))
+	}
+
+	plaintext, err := decrypter.Decrypt(ciphertext)
+
+	return editedSecret{plaintext: plaintext, encrypter: encrypter, prefix: prefix}, err
+}
+
+// Reencrypt decrypts every secure KMS value and encrypts it again under
+// newKeyID, envelope encrypting values that were envelope encrypted before
+// as well as those Envelope or size call for. Values from other providers
+// are left alone. It returns the nodes it touched as "section.key". Values
+// are only replaced once every node has been re-encrypted successfully.
+// Call Save to write the change to disk.
+func (c *Config) Reencrypt(newKeyID string) ([]string, error) {
+	if newKeyID == "" {
+		return nil, fmt.Errorf("a KMS key ID is required to re-encrypt secure values")
+	}
+
+	type reencryptedNode struct {
+		section        string
+		key            string
+		encryptedValue string
+	}
+
+	var reencryptedNodes []reencryptedNode
+
+	for sectionKey, sectionValue := range c.Snapshot().data {
+		for nodeKey, nodeValue := range sectionValue {
+			if secure, _ := nodeValue[secureFieldName].(bool); !secure || isReference(nodeValue) {
+				continue
+			}
+
+			encryptedValue, isString := nodeValue[valueFieldName].(string)
+			if !isString {
+				return nil, fmt.Errorf("secure value must be a string for node %s.%s", sectionKey, nodeKey)
+			}
+
+			decrypter, ciphertext, _, err := c.routeNode(sectionKey, nodeKey, nodeValue, encryptedValue)
+			if err != nil {
+				return nil, fmt.Errorf("error decrypting secure value for node %s.%s: %s", sectionKey, nodeKey, err.Error())
+			}
+
+			kmsWrapper, isKMS := decrypter.(KMSWrapper)
+			if !isKMS {
+				continue
+			}
+
+			plaintext, err := kmsWrapper.Decrypt(ciphertext)
+			if err != nil {
+				return nil, fmt.Errorf("error decrypting secure value for node %s.%s: %s", sectionKey, nodeKey, err.Error())
+			}
+
+			kmsWrapper.Envelope = kmsWrapper.Envelope || isEnvelope(ciphertext)
+			reencryptedValue, err := kmsWrapper.Encrypt(newKeyID, plaintext)
+			if err != nil {
+				return nil, fmt.Errorf("error encrypting secure value for node %s.%s: %s", sectionKey, nodeKey, err.Error())
+			}
+
+			prefix := encryptedValue[:len(encryptedValue)-len(ciphertext)]
+			reencryptedNodes = append(reencryptedNodes, reencryptedNode{sectionKey, nodeKey, prefix + reencryptedValue})
+		}
+	}
+
+	nodes := make([]string, 0, len(reencryptedNodes))
+	err := c.updateData(func(data map[string]map[string]map[string]interface{}) error {
+		for _, node := range reencryptedNodes {
+			nodeData, err := editableNode(data, node.section, node.key)
+			if err != nil {
+				return err
+			}
+
+			nodeData[valueFieldName] = node.encryptedValue
+			nodes = append(nodes, node.section+"."+node.key)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(nodes)
+	return nodes, nil
+}
+
+// updateData applies update to a copy of the stored values and swaps the
+// copy in, leaving earlier snapshots unchanged.
+func (c *Config) updateData(update func(data map[string]map[string]map[string]interface{}) error) error {
+	return c.state().update(func(snapshot *Snapshot) error {
+		data := cloneData(snapshot.data)
+		err := update(data)
+		if err != nil {
+			return err
+		}
+
+		snapshot.data = data
+		return nil
+	})
+}
+
+func editableNode(data map[string]map[string]map[string]interface{}, node string, key string) (map[string]interface{}, error) {
+	if node == "" || key == "" {
+		return nil, fmt.Errorf("node and key must not be empty, got: '%s.%s'", node, key)
+	}
+
+	section, ok := data[node]
+	if !ok {
+		section = make(map[string]map[string]interface{})
+		data[node] = section
+	}
+
+	nodeData, ok := section[key]
+	if !ok {
+		nodeData = make(map[string]interface{})
+		section[key] = nodeData
+	}
+
+	return nodeData, nil
+}
+
+func (s *Snapshot) storedNode(node string, key string) (map[string]interface{}, error) {
+	section, ok := s.data[node]
+	if !ok {
+		return nil, fmt.Errorf("The config node '%s' doesn't exist", node)
+	}
+
+	nodeData, ok := section[key]
+	if !ok {
+		return nil, fmt.Errorf("'%s' key doesn't exists on node '%s'", key, node)
+	}
+
+	return nodeData, nil
+}
+
+// encodeJSON encodes the value the way config files are formatted: indented
+// with two spaces, without HTML escaping and with a trailing newline.
+func encodeJSON(value interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+
+	err := encoder.Encode(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func writeFileAtomically(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(file.Name(), mode)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
@@ -2,11 +2,13 @@ package kmsconfig
 
 type (
 	// ConfigNode a node in the config, a child of a
-	// ConfigSection.
+	// ConfigSection. Sources records how the value was
+	// resolved, in order, with the last source winning.
 	ConfigNode struct {
 		Name           string
 		Value          interface{}
 		EncryptedValue string
 		Secure         bool
+		Sources        []Source
 	}
 )
@@ -0,0 +1,118 @@
+package kmsconfig
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type (
+	debugDocument struct {
+		Env      string                          `json:"env"`
+		LoadedAt *time.Time                      `json:"loaded_at,omitempty"`
+		Sections map[string]map[string]debugNode `json:"sections"`
+	}
+
+	debugNode struct {
+		Type    string      `json:"type"`
+		Value   interface{} `json:"value"`
+		Secure  bool        `json:"secure"`
+		Sources []string    `json:"sources"`
+	}
+)
+
+// DebugHandler returns an http.Handler that serves the effective config as
+// JSON: the environment, when it was last loaded or reloaded, and each node
+// with its type, sources and secure flag. Secure values are redacted, or
+// replaced with a short HMAC of their plaintext when hashSecrets is true.
+// The HMAC is keyed with DebugHashKey, or a random key for the process, so
+// it shows whether a secret changed without letting guesses be checked
+// against it.
+func (c Config) DebugHandler(hashSecrets bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		contents, err := encodeJSON(c.debugDocument(hashSecrets))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(contents)
+	})
+}
+
+// DebugVar returns an expvar.Var with the same document as DebugHandler,
+// for publishing with expvar.Publish.
+func (c Config) DebugVar(hashSecrets bool) expvar.Var {
+	return expvar.Func(func() interface{} {
+		return c.debugDocument(hashSecrets)
+	})
+}
+
+func (c Config) debugDocument(hashSecrets bool) debugDocument {
+	snapshot := c.Snapshot()
+	document := debugDocument{
+		Env:      snapshot.env,
+		Sections: make(map[string]map[string]debugNode, len(snapshot.sections)),
+	}
+
+	if loadedAt := snapshot.loadedAt; !loadedAt.IsZero() {
+		document.LoadedAt = &loadedAt
+	}
+
+	for sectionKey, section := range snapshot.sections {
+		nodes := make(map[string]debugNode, len(section.Nodes))
+		for nodeKey, node := range section.Nodes {
+			debugNode := debugNode{
+				Type:    valueType(node.Value),
+				Value:   node.Value,
+				Secure:  node.Secure,
+				Sources: make([]string, 0, len(node.Sources)),
+			}
+
+			if node.Secure {
+				debugNode.Value = redactedValue
+				if hashSecrets {
+					debugNode.Value = c.plaintextHash(fmt.Sprint(node.Value))
+				}
+			}
+
+			for _, source := range node.Sources {
+				debugNode.Sources = append(debugNode.Sources, source.String())
+			}
+
+			nodes[nodeKey] = debugNode
+		}
+
+		document.Sections[sectionKey] = nodes
+	}
+
+	return document
+}
+
+// valueType names the JSON type of a node value.
+func valueType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64, int, int64:
+		return "number"
+	case []interface{}, []string:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
@@ -0,0 +1,207 @@
+package kmsconfig
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	kmsLocation          = "kms"
+	decryptCacheLocation = "cache"
+)
+
+type (
+	cachedPlaintext struct {
+		plaintext string
+		keyID     string
+		expires   time.Time
+	}
+)
+
+// decryptSecureValue decrypts a secure value with the decrypter it's routed
+// to by its prefix.
+func (c Config) decryptSecureValue(ctx context.Context, section string, key string, value string) (string, Source, error) {
+	return c.decryptSecureNode(ctx, section, key, nil, value)
+}
+
+// decryptSecureNode decrypts the secure value of a node with the decrypter
+// it's routed to, from the decrypt cache if DecryptCacheTTL is set and the
+// same decrypter decrypted it recently, returning the source to record for
+// the node.
+func (c Config) decryptSecureNode(ctx context.Context, section string, key string, nodeValue map[string]interface{}, value string) (string, Source, error) {
+	decrypter, ciphertext, name, err := c.routeNode(section, key, nodeValue, value)
+	if err != nil {
+		return "", Source{}, err
+	}
+
+	cacheKey := decryptCacheKey(decrypter, value)
+	if plaintext, ok := c.cachedPlaintext(cacheKey, decrypter); ok {
+		c.logger().Debug("Decrypted secure config value from cache", "section", section, "key", key)
+		c.observer().ObserveDecrypt(ctx, DecryptEvent{Section: section, Key: key, CacheHit: true})
+
+		return plaintext, Source{SourceDecrypted, decryptCacheLocation}, nil
+	}
+
+	start := time.Now()
+	decryptedValue, keyID, err := decryptWithKeyID(ctx, decrypter, ciphertext)
+	duration := time.Since(start)
+	c.observer().ObserveDecrypt(ctx, DecryptEvent{Section: section, Key: key, Duration: duration, Err: err})
+
+	if err != nil {
+		c.logger().Error(
+			"Could not decrypt secure config value",
+			"section", section, "key", key, "duration", duration, "error", err,
+		)
+		return "", Source{}, err
+	}
+
+	c.logger().Debug(
+		"Decrypted secure config value",
+		"section", section, "key", key, "duration", duration,
+	)
+	c.cachePlaintext(cacheKey, decryptedValue, keyID)
+
+	return decryptedValue, Source{SourceDecrypted, name}, nil
+}
+
+// decryptWithKeyID decrypts ciphertext, with ctx if the decrypter is a
+// ContextDecrypter, also returning the key KMS decrypted it with when the
+// decrypter is a KMSWrapper.
+func decryptWithKeyID(ctx context.Context, decrypter Decrypter, ciphertext string) (string, string, error) {
+	if kmsWrapper, isKMS := decrypter.(KMSWrapper); isKMS {
+		return kmsWrapper.decryptWithKeyID(ctx, ciphertext)
+	}
+
+	if contextDecrypter, ok := decrypter.(ContextDecrypter); ok {
+		plaintext, err := contextDecrypter.DecryptContext(ctx, ciphertext)
+		return plaintext, "", err
+	}
+
+	plaintext, err := decrypter.Decrypt(ciphertext)
+	return plaintext, "", err
+}
+
+// decryptCacheKey identifies a secure value together with the decrypter
+// that decrypts it, so that plaintext cached for one decrypter is never
+// served once the Decrypter, KeyFiles or KMS settings change. Decrypters
+// that can't be told apart, being neither a KMSWrapper nor a pointer, get
+// an empty key and are never cached.
+func decryptCacheKey(decrypter Decrypter, value string) string {
+	kmsWrapper, isKMS := decrypter.(KMSWrapper)
+	if !isKMS {
+		identity, ok := pointerIdentity(decrypter)
+		if !ok {
+			return ""
+		}
+
+		return value + "|" + identity
+	}
+
+	client, ok := pointerIdentity(kmsWrapper.Client)
+	if !ok && kmsWrapper.Client != nil {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(kmsWrapper.EncryptionContext))
+	for contextKey, contextValue := range kmsWrapper.EncryptionContext {
+		pairs = append(pairs, contextKey+"="+contextValue)
+	}
+	sort.Strings(pairs)
+
+	allowedKeyIDs := slices.Clone(kmsWrapper.AllowedKeyIDs)
+	sort.Strings(allowedKeyIDs)
+
+	return strings.Join([]string{
+		value,
+		kmsLocation,
+		client,
+		strings.Join(pairs, ","),
+		strings.Join(allowedKeyIDs, ","),
+	}, "|")
+}
+
+// pointerIdentity names the value a pointer points to by its type and
+// address.
+func pointerIdentity(value interface{}) (string, bool) {
+	if value == nil || reflect.ValueOf(value).Kind() != reflect.Pointer {
+		return "", false
+	}
+
+	return fmt.Sprintf("%T@%p", value, value), true
+}
+
+// decrypter returns the key file for the environment if there is one,
+// otherwise the Decrypter, or the KMSWrapper if it isn't set.
+func (c Config) decrypter() Decrypter {
+	if decrypter, ok := c.keyFileDecrypter(); ok {
+		return decrypter
+	}
+
+	if c.Decrypter == nil {
+		return c.KMSWrapper
+	}
+
+	return c.Decrypter
+}
+
+// decrypterLocation names a decrypter or encrypter for the source of the
+// values it decrypts.
+func decrypterLocation(decrypter interface{}) string {
+	if stringer, ok := decrypter.(fmt.Stringer); ok {
+		return stringer.String()
+	}
+
+	return fmt.Sprintf("%T", decrypter)
+}
+
+// cachedPlaintext returns the plaintext cached for a value, as long as it
+// hasn't expired and, for KMS, the key it was decrypted with is still
+// allowed.
+func (c Config) cachedPlaintext(cacheKey string, decrypter Decrypter) (string, bool) {
+	if c.DecryptCacheTTL <= 0 || c.shared == nil || cacheKey == "" {
+		return "", false
+	}
+
+	c.shared.cacheMutex.Lock()
+	defer c.shared.cacheMutex.Unlock()
+
+	entry, ok := c.shared.decryptCache[cacheKey]
+	if !ok || time.Now().After(entry.expires) {
+		return "", false
+	}
+
+	if kmsWrapper, isKMS := decrypter.(KMSWrapper); isKMS && !kmsWrapper.keyAllowed(entry.keyID) {
+		return "", false
+	}
+
+	return entry.plaintext, true
+}
+
+// cachePlaintext caches a decrypted value for DecryptCacheTTL, dropping
+// any entries that have expired so the cache doesn't outgrow the config.
+func (c Config) cachePlaintext(cacheKey string, plaintext string, keyID string) {
+	if c.DecryptCacheTTL <= 0 || c.shared == nil || cacheKey == "" {
+		return
+	}
+
+	c.shared.cacheMutex.Lock()
+	defer c.shared.cacheMutex.Unlock()
+
+	now := time.Now()
+	if c.shared.decryptCache == nil {
+		c.shared.decryptCache = make(map[string]cachedPlaintext)
+	}
+
+	for cachedKey, entry := range c.shared.decryptCache {
+		if now.After(entry.expires) {
+			delete(c.shared.decryptCache, cachedKey)
+		}
+	}
+
+	c.shared.decryptCache[cacheKey] = cachedPlaintext{plaintext, keyID, now.Add(c.DecryptCacheTTL)}
+}
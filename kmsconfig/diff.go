@@ -0,0 +1,202 @@
+package kmsconfig
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+const (
+	// DifferenceMissing a node present in only one of the configs.
+	DifferenceMissing DifferenceKind = "missing"
+	// DifferenceSecure a node whose secure flag differs.
+	DifferenceSecure DifferenceKind = "secure"
+	// DifferenceValue a plain node whose value differs.
+	DifferenceValue DifferenceKind = "value"
+	// DifferenceSecret a secure node whose decrypted value differs.
+	DifferenceSecret DifferenceKind = "secret"
+)
+
+type (
+	// DifferenceKind describes how a node differs between two configs.
+	DifferenceKind string
+
+	// Difference a node that differs between two configs, with A and B
+	// describing the node in each. Secret values are only ever described
+	// by a hash of their plaintext.
+	Difference struct {
+		Node string
+		Kind DifferenceKind
+		A    string
+		B    string
+	}
+)
+
+func (d Difference) String() string {
+	return fmt.Sprintf("%s: %s differs: %s != %s", d.Node, d.Kind, d.A, d.B)
+}
+
+// Diff compares the stored values of two configs that have been read with
+// Read or Load, listing nodes present in only one of them, nodes whose
+// secure flag differs and plain nodes whose value differs. When decrypt is
+// true, secure nodes in both configs are decrypted with each config's
+// decrypter and compared by plaintext, with both sides hashed using a's
+// DebugHashKey so that they're comparable.
+func Diff(a *Config, b *Config, decrypt bool) ([]Difference, error) {
+	var differences []Difference
+	dataA := a.Snapshot().data
+	dataB := b.Snapshot().data
+	hashKey := a.hashKey()
+
+	for _, sectionKey := range unionKeys(dataA, dataB) {
+		for _, nodeKey := range unionKeys(dataA[sectionKey], dataB[sectionKey]) {
+			nodePath := sectionKey + "." + nodeKey
+			nodeA, inA := dataA[sectionKey][nodeKey]
+			nodeB, inB := dataB[sectionKey][nodeKey]
+
+			if !inA || !inB {
+				differences = append(differences, Difference{nodePath, DifferenceMissing, presence(inA), presence(inB)})
+				continue
+			}
+
+			secureA, _ := nodeA[secureFieldName].(bool)
+			secureB, _ := nodeB[secureFieldName].(bool)
+
+			switch {
+			case secureA != secureB:
+				differences = append(differences, Difference{nodePath, DifferenceSecure, fmt.Sprint(secureA), fmt.Sprint(secureB)})
+			case isReference(nodeA) || isReference(nodeB):
+				referenceA, referenceB := describeReference(nodeA), describeReference(nodeB)
+				if referenceA != referenceB {
+					differences = append(differences, Difference{nodePath, DifferenceValue, referenceA, referenceB})
+				}
+			case !secureA:
+				if !reflect.DeepEqual(nodeA[valueFieldName], nodeB[valueFieldName]) {
+					differences = append(differences, Difference{nodePath, DifferenceValue, describeValue(nodeA[valueFieldName]), describeValue(nodeB[valueFieldName])})
+				}
+			case decrypt:
+				hashA, err := a.secretHash(sectionKey, nodeKey, nodeA, hashKey)
+				if err != nil {
+					return nil, err
+				}
+
+				hashB, err := b.secretHash(sectionKey, nodeKey, nodeB, hashKey)
+				if err != nil {
+					return nil, err
+				}
+
+				if hashA != hashB {
+					differences = append(differences, Difference{nodePath, DifferenceSecret, hashA, hashB})
+				}
+			}
+		}
+	}
+
+	return differences, nil
+}
+
+func (c Config) secretHash(sectionKey string, nodeKey string, nodeValue map[string]interface{}, hashKey []byte) (string, error) {
+	encryptedValue, isString := nodeValue[valueFieldName].(string)
+	if !isString {
+		return "", fmt.Errorf("secure value must be a string for node %s.%s", sectionKey, nodeKey)
+	}
+
+	decrypter, ciphertext, _, err := c.routeNode(sectionKey, nodeKey, nodeValue, encryptedValue)
+	if err != nil {
+		return "", fmt.Errorf("error decrypting secure value for node %s.%s in %s: %s", sectionKey, nodeKey, c.Env, err.Error())
+	}
+
+	plaintext, err := decrypter.Decrypt(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("error decrypting secure value for node %s.%s in %s: %s", sectionKey, nodeKey, c.Env, err.Error())
+	}
+
+	return hashPlaintext(hashKey, plaintext), nil
+}
+
+// plaintextHashKey keys plaintextHash with a random key for each process
+// when DebugHashKey isn't set, so that hashes can't be checked against
+// guessed secrets.
+var plaintextHashKey = func() []byte {
+	key := make([]byte, sha256.Size)
+	_, err := rand.Read(key)
+	if err != nil {
+		panic(fmt.Sprintf("kmsconfig: could not generate a key for hashing secrets: %s", err))
+	}
+
+	return key
+}()
+
+// hashKey returns DebugHashKey, or the random key for the process if it
+// isn't set.
+func (c Config) hashKey() []byte {
+	if len(c.DebugHashKey) == 0 {
+		return plaintextHashKey
+	}
+
+	return c.DebugHashKey
+}
+
+// plaintextHash returns a short HMAC of a secret, keyed with DebugHashKey
+// or a random key for the process, for telling values apart without
+// revealing them.
+func (c Config) plaintextHash(plaintext string) string {
+	return hashPlaintext(c.hashKey(), plaintext)
+}
+
+func hashPlaintext(key []byte, plaintext string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(plaintext))
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// describeReference describes a node by the value it refers to, so that
+// nodes referring to the same value compare equal however they refer to it.
+func describeReference(nodeValue map[string]interface{}) string {
+	if name, ok := ssmReference(nodeValue, nodeValue[valueFieldName], false); ok {
+		return ssmReferencePrefix + name
+	}
+
+	return describeValue(nodeValue[valueFieldName])
+}
+
+func describeValue(value interface{}) string {
+	encodedValue, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+
+	return string(encodedValue)
+}
+
+func presence(present bool) string {
+	if present {
+		return "present"
+	}
+
+	return "missing"
+}
+
+// unionKeys returns the keys present in either map, sorted.
+func unionKeys[V any](a map[string]V, b map[string]V) []string {
+	keys := make(map[string]struct{})
+	for key := range a {
+		keys[key] = struct{}{}
+	}
+	for key := range b {
+		keys[key] = struct{}{}
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+
+	sort.Strings(sorted)
+	return sorted
+}
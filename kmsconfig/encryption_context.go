@@ -0,0 +1,43 @@
+package kmsconfig
+
+import "os"
+
+const encryptionContextFieldName = "encryption_context"
+
+// nodeKMSWrapper returns a copy of the KMSWrapper for a node, adding to its
+// encryption context the config's EncryptionContext, with ${env},
+// ${section}, ${key} and ${node} expanded, and the node's
+// encryption_context field.
+func (c Config) nodeKMSWrapper(kmsWrapper KMSWrapper, section string, key string, nodeValue map[string]interface{}) KMSWrapper {
+	nodeContext, _ := nodeValue[encryptionContextFieldName].(map[string]interface{})
+	if len(c.EncryptionContext) == 0 && len(nodeContext) == 0 {
+		return kmsWrapper
+	}
+
+	placeholders := map[string]string{
+		"env":     c.Env,
+		"section": section,
+		"key":     key,
+		"node":    section + "." + key,
+	}
+
+	encryptionContext := make(map[string]string, len(kmsWrapper.EncryptionContext)+len(c.EncryptionContext)+len(nodeContext))
+	for contextKey, contextValue := range kmsWrapper.EncryptionContext {
+		encryptionContext[contextKey] = contextValue
+	}
+
+	for contextKey, contextValue := range c.EncryptionContext {
+		encryptionContext[contextKey] = os.Expand(contextValue, func(placeholder string) string {
+			return placeholders[placeholder]
+		})
+	}
+
+	for contextKey, contextValue := range nodeContext {
+		if stringValue, ok := contextValue.(string); ok {
+			encryptionContext[contextKey] = stringValue
+		}
+	}
+
+	kmsWrapper.EncryptionContext = encryptionContext
+	return kmsWrapper
+}
@@ -1,28 +1,76 @@
 package kmsconfig
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 )
 
-func loadEnvConfig(config interface{}, kmsWrapper KMSWrapper) error {
+type (
+	// secureValueDecrypter decrypts the secure value of a node, returning
+	// the source to record for it.
+	secureValueDecrypter func(ctx context.Context, section string, key string, value string) (string, Source, error)
+
+	envConfigField struct {
+		value   reflect.Value
+		field   reflect.StructField
+		section string
+		key     string
+	}
+)
+
+// loadEnvConfig populates the config from environment variables, recording
+// each value in sections, and returns any VIDSY_VAR_* variables that no
+// field of the config maps to.
+func loadEnvConfig(ctx context.Context, config interface{}, decrypt secureValueDecrypter, sections map[string]ConfigSection) ([]string, error) {
 	ctype := reflect.ValueOf(config)
 	if ctype.Kind() != reflect.Ptr {
-		return fmt.Errorf("config must be a pointer")
+		return nil, fmt.Errorf("config must be a pointer")
 	}
 	if ctype.Elem().Kind() != reflect.Struct {
-		return fmt.Errorf("config must be a struct pointer")
+		return nil, fmt.Errorf("config must be a struct pointer")
 	}
 	ctype = ctype.Elem()
 	configMap, err := buildConfigMap(ctype)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	err = populateConfigFromEnv(ctx, configMap, decrypt, sections)
+	if err != nil {
+		return nil, err
+	}
+
+	err = buildEnvSections(ctype)
+	if err != nil {
+		return nil, err
+	}
+
+	return unmatchedEnvVars(configMap), nil
+}
+
+// buildEnvSections builds the sections, such as TLSKeyPair, that derive
+// fields from their nodes once they've been populated.
+func buildEnvSections(config reflect.Value) error {
+	for i := 0; i < config.NumField(); i++ {
+		namespaceTag := config.Type().Field(i).Tag.Get(configNodeName)
+		if namespaceTag == configOmitField {
+			continue
+		}
+
+		if builder, ok := config.Field(i).Addr().Interface().(sectionBuilder); ok {
+			err := builder.build(namespaceTag)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
-	return populateConfigFromEnv(configMap, kmsWrapper)
+	return nil
 }
 
 // buildConfigMap iterates over the fields of the config struct and builds a map of the field names to their values.
@@ -31,8 +79,8 @@ func loadEnvConfig(config interface{}, kmsWrapper KMSWrapper) error {
 // The function builds the map iterating over the "namespaces" and values, building the map keys as the corresponding environment
 // variables holding the values.
 // The map is then compared to the actual environment variables and the values are set accordingly.
-func buildConfigMap(config reflect.Value) (map[string]reflect.Value, error) {
-	configMap := make(map[string]reflect.Value)
+func buildConfigMap(config reflect.Value) (map[string]envConfigField, error) {
+	configMap := make(map[string]envConfigField)
 	configType := config.Type()
 
 	for i := 0; i < config.NumField(); i++ {
@@ -68,14 +116,14 @@ func buildConfigMap(config reflect.Value) (map[string]reflect.Value, error) {
 					configType.Field(i).Name, configFieldType.Field(j).Name, envVar)
 			}
 
-			configMap[envVar] = configFieldValue
+			configMap[envVar] = envConfigField{configFieldValue, configFieldType.Field(j), namespaceTag, fieldTag}
 		}
 	}
 
 	return configMap, nil
 }
 
-func populateConfigFromEnv(configMap map[string]reflect.Value, kmsWrapper KMSWrapper) error {
+func populateConfigFromEnv(ctx context.Context, configMap map[string]envConfigField, decrypt secureValueDecrypter, sections map[string]ConfigSection) error {
 	envVars := map[string]string{}
 	for _, envVar := range os.Environ() {
 		v := strings.SplitN(envVar, "=", 2)
@@ -95,30 +143,93 @@ func populateConfigFromEnv(configMap map[string]reflect.Value, kmsWrapper KMSWra
 		}
 	}
 
-	// we expect to find all the environment variables from the config map
-	for envVarName, value := range configMap {
+	// we expect to find all the environment variables from the config map,
+	// other than those with a default
+	for envVarName, field := range configMap {
+		node := ConfigNode{
+			Name:    field.key,
+			Sources: []Source{{SourceEnvironment, envVarName}},
+		}
+
 		envValue, ok := envVars[envVarName]
 		if !ok {
-			return fmt.Errorf("environment variable %s not found", envVarName)
+			envValue, ok = field.field.Tag.Lookup(configDefaultNodeName)
+			if !ok {
+				return fmt.Errorf("environment variable %s not found", envVarName)
+			}
+
+			node.Sources = []Source{{SourceDefault, field.field.Name}}
 		}
 
 		if _, ok := encryptedVariablesMap[envVarName]; ok {
-			decryptedValue, err := kmsWrapper.Decrypt(envValue)
+			decryptedValue, source, err := decrypt(ctx, field.section, field.key, envValue)
 			if err != nil {
 				return fmt.Errorf("error decrypting environment variable %s: %w", envVarName, err)
 			}
+			node.Secure = true
+			node.EncryptedValue = envValue
+			node.Sources = append(node.Sources, source)
 			envValue = decryptedValue
 		}
 
-		err := assignEnvVarValue(value, envValue, envVarName)
+		if field.field.Tag.Get(configSecureNodeName) == "true" && !node.Secure {
+			return fmt.Errorf("environment variable %s must be listed in VIDSY_VAR_SECURED_ENVIRONMENT_VARIABLES", envVarName)
+		}
+
+		if holdsEncodedData(field.value.Type()) {
+			node.Value = envValue
+			err := assignNodeValue(field.section, field.key, field.field, field.value, node)
+			if err != nil {
+				return fmt.Errorf("error parsing environment variable %s: %w", envVarName, err)
+			}
+		} else {
+			err := assignEnvVarValue(field.value, envValue, envVarName)
+			if err != nil {
+				return err
+			}
+
+			node.Value = field.value.Interface()
+		}
+
+		err := checkConstraints(field.field, constraintData(field.value, node))
 		if err != nil {
-			return err
+			return fmt.Errorf("invalid environment variable %s: %w", envVarName, err)
 		}
+
+		section, ok := sections[field.section]
+		if !ok {
+			section = ConfigSection{field.section, make(map[string]ConfigNode)}
+			sections[field.section] = section
+		}
+		section.Nodes[field.key] = node
 	}
 
 	return nil
 }
 
+// constraintData returns the value of a populated field in the shape
+// checkConstraints expects, with numbers as float64 as they are in a JSON
+// config file.
+func constraintData(value reflect.Value, node ConfigNode) interface{} {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		return value.Float()
+	default:
+		return node.Value
+	}
+}
+
+// holdsEncodedData reports whether a field type is populated from base64 or
+// PEM encoded data, which is converted the same way as it is for values
+// read from a config file.
+func holdsEncodedData(fieldType reflect.Type) bool {
+	return fieldType == certPoolType || (fieldType.Kind() == reflect.Slice && fieldType.Elem().Kind() == reflect.Uint8)
+}
+
 func assignEnvVarValue(value reflect.Value, envValue string, envVarName string) error {
 	switch value.Kind() {
 	case reflect.String:
@@ -148,6 +259,14 @@ func assignEnvVarValue(value reflect.Value, envValue string, envVarName string)
 
 		value.SetUint(intValue)
 
+	case reflect.Float32, reflect.Float64:
+		floatValue, err := strconv.ParseFloat(envValue, value.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("error parsing environment variable %s: %w", envVarName, err)
+		}
+
+		value.SetFloat(floatValue)
+
 	case reflect.Bool:
 		boolValue, err := strconv.ParseBool(envValue)
 		if err != nil {
@@ -155,6 +274,9 @@ func assignEnvVarValue(value reflect.Value, envValue string, envVarName string)
 		}
 		value.SetBool(boolValue)
 
+	case reflect.Interface:
+		value.Set(reflect.ValueOf(envValue))
+
 	case reflect.Slice:
 		envValue = strings.TrimSpace(envValue)
 		envValue = strings.TrimPrefix(envValue, "[")
@@ -175,3 +297,24 @@ func assignEnvVarValue(value reflect.Value, envValue string, envVarName string)
 
 	return nil
 }
+
+func unmatchedEnvVars(configMap map[string]envConfigField) []string {
+	var unmatched []string
+	for _, envVar := range os.Environ() {
+		envVarName := strings.SplitN(envVar, "=", 2)[0]
+		if !strings.HasPrefix(envVarName, "VIDSY_VAR_") {
+			continue
+		}
+
+		if _, ok := envConfigReservedVariables[envVarName]; ok {
+			continue
+		}
+
+		if _, ok := configMap[envVarName]; !ok {
+			unmatched = append(unmatched, envVarName)
+		}
+	}
+
+	sort.Strings(unmatched)
+	return unmatched
+}
@@ -0,0 +1,88 @@
+package kmsconfig
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+const (
+	envelopeProvider = "envelope"
+	envelopePrefix   = envelopeProvider + ":"
+	// kmsMaxPlaintextSize is the most bytes KMS encrypts directly.
+	kmsMaxPlaintextSize = 4096
+)
+
+// encryptEnvelope encrypts the plaintext locally with AES-GCM under a data
+// key generated by KMS, returning "envelope:", the base64 encoded data key
+// as wrapped by KMS, ":" and the AES-GCM ciphertext.
+func (k KMSWrapper) encryptEnvelope(ctx context.Context, keyID string, plaintext string) (string, error) {
+	client, err := k.client()
+	if err != nil {
+		return "", err
+	}
+
+	output, err := client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		EncryptionContext: k.EncryptionContext,
+		GrantTokens:       k.GrantTokens,
+		KeyId:             aws.String(keyID),
+		KeySpec:           types.DataKeySpecAes256,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	dataKey, err := newAESGCMKey(output.Plaintext)
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := dataKey.Encrypt("", plaintext)
+	if err != nil {
+		return "", err
+	}
+
+	return envelopePrefix + base64.StdEncoding.EncodeToString(output.CiphertextBlob) + ":" + ciphertext, nil
+}
+
+// decryptEnvelope unwraps the data key of an envelope with KMS and decrypts
+// the value with it, returning the plaintext and the ARN of the KMS key.
+func (k KMSWrapper) decryptEnvelope(ctx context.Context, envelope string) (string, string, error) {
+	encodedDataKey, ciphertext, ok := strings.Cut(envelope, ":")
+	if !ok {
+		return "", "", fmt.Errorf("envelope must hold a data key and ciphertext")
+	}
+
+	wrappedDataKey, err := base64.StdEncoding.DecodeString(encodedDataKey)
+	if err != nil {
+		return "", "", fmt.Errorf("could not base64 decode envelope data key: %w", err)
+	}
+
+	plaintextDataKey, keyID, err := k.decryptBlob(ctx, wrappedDataKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	dataKey, err := newAESGCMKey(plaintextDataKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	plaintext, err := dataKey.Decrypt(ciphertext)
+	if err != nil {
+		return "", "", err
+	}
+
+	return plaintext, keyID, nil
+}
+
+// isEnvelope reports whether ciphertext was envelope encrypted, so that
+// re-encrypting it can keep the format.
+func isEnvelope(ciphertext string) bool {
+	return strings.HasPrefix(ciphertext, envelopePrefix)
+}
@@ -0,0 +1,46 @@
+package kmsconfig
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Explain describes how the value of a node was resolved, listing each of
+// its sources in order followed by the effective value. Nodes missing from
+// the config are explained by the config_default tag Populate last used for
+// them. The plaintext of secure values is never included.
+func (c Config) Explain(node string, key string) (string, error) {
+	configNode, err := c.retrieveNode(node, key)
+	if err != nil {
+		defaultNode, ok := c.defaultNode(node, key)
+		if !ok {
+			return "", err
+		}
+
+		configNode = defaultNode
+	}
+
+	var explanation strings.Builder
+	fmt.Fprintf(&explanation, "%s.%s\n", node, key)
+	for i, source := range configNode.Sources {
+		fmt.Fprintf(&explanation, "  %d. %s\n", i+1, source)
+	}
+
+	value := describeValue(configNode.Value)
+	if configNode.Secure {
+		value = redactedValue
+	}
+	fmt.Fprintf(&explanation, "  value: %s\n", value)
+
+	return explanation.String(), nil
+}
+
+// defaultNode returns the node Populate last filled from a config_default
+// tag for a section and key.
+func (c Config) defaultNode(node string, key string) (ConfigNode, bool) {
+	if c.shared == nil {
+		return ConfigNode{}, false
+	}
+
+	return c.shared.defaultNode(node, key)
+}
@@ -0,0 +1,126 @@
+package kmsconfig_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type (
+	// fakeKMSEndpoint serves the KMS JSON protocol and STS AssumeRole over
+	// HTTP, so KMS clients built from options can be pointed at it. It
+	// "encrypts" the same way fakekms.KMS does, without encryption contexts.
+	fakeKMSEndpoint struct {
+		*httptest.Server
+		mutex    sync.Mutex
+		requests []fakeKMSRequest
+	}
+
+	fakeKMSRequest struct {
+		Target        string
+		Authorization string
+		Body          map[string]interface{}
+	}
+)
+
+func newFakeKMSEndpoint(t *testing.T) *fakeKMSEndpoint {
+	endpoint := &fakeKMSEndpoint{}
+	endpoint.Server = httptest.NewServer(http.HandlerFunc(endpoint.serveHTTP))
+	t.Cleanup(endpoint.Close)
+
+	return endpoint
+}
+
+func (e *fakeKMSEndpoint) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	target := r.Header.Get("X-Amz-Target")
+	if target == "" {
+		e.assumeRole(w, r)
+		return
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	e.record(fakeKMSRequest{target, r.Header.Get("Authorization"), body})
+
+	var response map[string]interface{}
+	switch target {
+	case "TrentService.Encrypt":
+		keyID, _ := body["KeyId"].(string)
+		plaintext, _ := body["Plaintext"].(string)
+		decoded, _ := base64.StdEncoding.DecodeString(plaintext)
+		response = map[string]interface{}{
+			"CiphertextBlob": base64.StdEncoding.EncodeToString([]byte(keyID + "|" + string(decoded))),
+			"KeyId":          keyID,
+		}
+	case "TrentService.Decrypt":
+		ciphertext, _ := body["CiphertextBlob"].(string)
+		decoded, _ := base64.StdEncoding.DecodeString(ciphertext)
+		keyID, plaintext, _ := strings.Cut(string(decoded), "|")
+		response = map[string]interface{}{
+			"KeyId":     keyID,
+			"Plaintext": base64.StdEncoding.EncodeToString([]byte(plaintext)),
+		}
+	default:
+		http.Error(w, "unsupported target "+target, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (e *fakeKMSEndpoint) assumeRole(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.Form.Get("Action") != "AssumeRole" {
+		http.Error(w, "unsupported request", http.StatusBadRequest)
+		return
+	}
+
+	e.record(fakeKMSRequest{
+		Target:        "STS.AssumeRole",
+		Authorization: r.Header.Get("Authorization"),
+		Body: map[string]interface{}{
+			"RoleArn":         r.Form.Get("RoleArn"),
+			"ExternalId":      r.Form.Get("ExternalId"),
+			"RoleSessionName": r.Form.Get("RoleSessionName"),
+		},
+	})
+
+	w.Header().Set("Content-Type", "text/xml")
+	_, _ = w.Write([]byte(`<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>ASSUMEDROLEKEY</AccessKeyId>
+      <SecretAccessKey>assumed-secret</SecretAccessKey>
+      <SessionToken>assumed-token</SessionToken>
+      <Expiration>2099-01-01T00:00:00Z</Expiration>
+    </Credentials>
+    <AssumedRoleUser>
+      <Arn>arn:aws:sts::123456789012:assumed-role/config/session</Arn>
+      <AssumedRoleId>AROA:session</AssumedRoleId>
+    </AssumedRoleUser>
+  </AssumeRoleResult>
+</AssumeRoleResponse>`))
+}
+
+func (e *fakeKMSEndpoint) record(request fakeKMSRequest) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.requests = append(e.requests, request)
+}
+
+// received returns the requests made so far.
+func (e *fakeKMSEndpoint) received() []fakeKMSRequest {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return append([]fakeKMSRequest(nil), e.requests...)
+}
@@ -0,0 +1,57 @@
+package kmsconfig_test
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	kmsv1 "github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+
+	"github.com/vidsy/go-kmsconfig/v6/internal/fakekms"
+)
+
+// fakeKMSV1 is an aws-sdk-go v1 KMS client backed by fakekms.KMS, so values
+// encrypted through KMSV1Adapter decrypt with the v2 fake and vice versa.
+type fakeKMSV1 struct {
+	kmsiface.KMSAPI
+	fake fakekms.KMS
+}
+
+func (f *fakeKMSV1) EncryptWithContext(ctx aws.Context, input *kmsv1.EncryptInput, _ ...request.Option) (*kmsv1.EncryptOutput, error) {
+	output, err := f.fake.Encrypt(ctx, &kms.EncryptInput{
+		EncryptionContext: aws.StringValueMap(input.EncryptionContext),
+		KeyId:             input.KeyId,
+		Plaintext:         input.Plaintext,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &kmsv1.EncryptOutput{CiphertextBlob: output.CiphertextBlob, KeyId: output.KeyId}, nil
+}
+
+func (f *fakeKMSV1) GenerateDataKeyWithContext(ctx aws.Context, input *kmsv1.GenerateDataKeyInput, _ ...request.Option) (*kmsv1.GenerateDataKeyOutput, error) {
+	output, err := f.fake.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		EncryptionContext: aws.StringValueMap(input.EncryptionContext),
+		KeyId:             input.KeyId,
+		KeySpec:           types.DataKeySpec(aws.StringValue(input.KeySpec)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &kmsv1.GenerateDataKeyOutput{CiphertextBlob: output.CiphertextBlob, KeyId: output.KeyId, Plaintext: output.Plaintext}, nil
+}
+
+func (f *fakeKMSV1) DecryptWithContext(ctx aws.Context, input *kmsv1.DecryptInput, _ ...request.Option) (*kmsv1.DecryptOutput, error) {
+	output, err := f.fake.Decrypt(ctx, &kms.DecryptInput{
+		CiphertextBlob:    input.CiphertextBlob,
+		EncryptionContext: aws.StringValueMap(input.EncryptionContext),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &kmsv1.DecryptOutput{KeyId: output.KeyId, Plaintext: output.Plaintext}, nil
+}
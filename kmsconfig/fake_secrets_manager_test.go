@@ -0,0 +1,40 @@
+package kmsconfig_test
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// fakeSecretsManager serves secrets from a map keyed by name and version
+// stage, and records the secrets requested.
+type fakeSecretsManager struct {
+	secrets  map[string]string
+	requests []string
+}
+
+func newFakeSecretsManager() *fakeSecretsManager {
+	return &fakeSecretsManager{secrets: make(map[string]string)}
+}
+
+func (f *fakeSecretsManager) GetSecretValue(_ context.Context, input *secretsmanager.GetSecretValueInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	stage := aws.ToString(input.VersionStage)
+	if stage == "" {
+		stage = "AWSCURRENT"
+	}
+
+	key := aws.ToString(input.SecretId) + "@" + stage
+	f.requests = append(f.requests, key)
+
+	value, ok := f.secrets[key]
+	if !ok {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("secret not found")}
+	}
+
+	return &secretsmanager.GetSecretValueOutput{
+		Name:         input.SecretId,
+		SecretString: aws.String(value),
+	}, nil
+}
@@ -0,0 +1,49 @@
+package kmsconfig_test
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// fakeSSM serves parameters from a map and records the names requested by
+// each GetParameters call.
+type fakeSSM struct {
+	parameters map[string]types.Parameter
+	batches    [][]string
+}
+
+func newFakeSSM() *fakeSSM {
+	return &fakeSSM{parameters: make(map[string]types.Parameter)}
+}
+
+func (f *fakeSSM) put(name string, parameterType types.ParameterType, value string) {
+	f.parameters[name] = types.Parameter{
+		Name:  aws.String(name),
+		Type:  parameterType,
+		Value: aws.String(value),
+	}
+}
+
+func (f *fakeSSM) GetParameters(ctx context.Context, input *ssm.GetParametersInput, _ ...func(*ssm.Options)) (*ssm.GetParametersOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.batches = append(f.batches, input.Names)
+
+	output := &ssm.GetParametersOutput{}
+	for _, name := range input.Names {
+		parameter, ok := f.parameters[name]
+		if !ok || (parameter.Type == types.ParameterTypeSecureString && !aws.ToBool(input.WithDecryption)) {
+			output.InvalidParameters = append(output.InvalidParameters, name)
+			continue
+		}
+
+		output.Parameters = append(output.Parameters, parameter)
+	}
+
+	return output, nil
+}
@@ -0,0 +1,101 @@
+package kmsconfig_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeVault stands in for a Vault server. Transit ciphertext is the
+// plaintext base64 encoded behind vault:v1:, KV v2 secrets are served from a
+// map keyed by mount and path, and logins issue tokens from the credentials
+// it's given.
+type fakeVault struct {
+	*httptest.Server
+	mutex   sync.Mutex
+	secrets map[string]map[string]interface{}
+	tokens  map[string]bool
+	logins  int
+}
+
+func newFakeVault(t *testing.T) *fakeVault {
+	vault := &fakeVault{
+		secrets: make(map[string]map[string]interface{}),
+		tokens:  map[string]bool{"root-token": true},
+	}
+	vault.Server = httptest.NewServer(http.HandlerFunc(vault.serve))
+	t.Cleanup(vault.Close)
+
+	return vault
+}
+
+func (f *fakeVault) revokeTokens() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.tokens = map[string]bool{"root-token": true}
+}
+
+func (f *fakeVault) serve(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var body map[string]string
+	json.NewDecoder(r.Body).Decode(&body)
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+
+	switch {
+	case path == "auth/approle/login" && body["role_id"] == "role" && body["secret_id"] == "secret":
+		f.login(w, "approle-token")
+	case path == "auth/kubernetes/login" && body["role"] == "app" && body["jwt"] == "service-account-jwt":
+		f.login(w, "kubernetes-token")
+	case strings.HasPrefix(path, "auth/"):
+		f.fail(w, http.StatusBadRequest, "invalid credentials")
+	case !f.tokens[r.Header.Get("X-Vault-Token")]:
+		f.fail(w, http.StatusForbidden, "permission denied")
+	case path == "transit/decrypt/config":
+		plaintext, ok := strings.CutPrefix(body["ciphertext"], "vault:v1:")
+		if !ok {
+			f.fail(w, http.StatusBadRequest, "invalid ciphertext")
+			return
+		}
+		f.respond(w, map[string]interface{}{"plaintext": plaintext})
+	case path == "transit/encrypt/config":
+		f.respond(w, map[string]interface{}{"ciphertext": "vault:v1:" + body["plaintext"]})
+	default:
+		mount, secretPath, _ := strings.Cut(path, "/data/")
+		data, ok := f.secrets[mount+"/"+secretPath]
+		if !ok {
+			f.fail(w, http.StatusNotFound, "")
+			return
+		}
+		f.respond(w, map[string]interface{}{"data": data, "metadata": map[string]interface{}{"version": 1}})
+	}
+}
+
+func (f *fakeVault) login(w http.ResponseWriter, token string) {
+	f.logins++
+	f.tokens[token] = true
+	json.NewEncoder(w).Encode(map[string]interface{}{"auth": map[string]interface{}{"client_token": token}})
+}
+
+func (f *fakeVault) respond(w http.ResponseWriter, data map[string]interface{}) {
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func (f *fakeVault) fail(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	errors := []string{}
+	if message != "" {
+		errors = append(errors, message)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"errors": errors})
+}
+
+func vaultCiphertext(plaintext string) string {
+	return "vault:v1:" + base64.StdEncoding.EncodeToString([]byte(plaintext))
+}
@@ -0,0 +1,82 @@
+package kmsconfig
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// defaultNodeData parses a config_default tag into the shape the value
+// would have had if it were read from a JSON config file.
+func defaultNodeData(fieldType reflect.Type, defaultValue string) (interface{}, error) {
+	switch fieldType.Kind() {
+	case reflect.String:
+		return defaultValue, nil
+	case reflect.Bool:
+		return strconv.ParseBool(defaultValue)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(defaultValue, 64)
+	case reflect.Slice:
+		if fieldType.Elem().Kind() == reflect.Uint8 {
+			return defaultValue, nil
+		}
+
+		values := []interface{}{}
+		if defaultValue == "" {
+			return values, nil
+		}
+
+		for _, value := range strings.Split(defaultValue, ",") {
+			values = append(values, value)
+		}
+
+		return values, nil
+	default:
+		return nil, fmt.Errorf("default values aren't supported for fields of kind %s", fieldType.Kind())
+	}
+}
+
+// checkConstraints applies the config_enum, config_min and config_max tags
+// of a field to the value of its config node.
+func checkConstraints(field reflect.StructField, nodeData interface{}) error {
+	if enum, ok := field.Tag.Lookup(configEnumNodeName); ok {
+		value := fmt.Sprint(nodeData)
+		if !slices.Contains(strings.Split(enum, ","), value) {
+			return fmt.Errorf("expected one of [%s], got: %s", enum, value)
+		}
+	}
+
+	bounds := []struct {
+		tag         string
+		description string
+		inBounds    func(value float64, limit float64) bool
+	}{
+		{configMinNodeName, "at least", func(value float64, limit float64) bool { return value >= limit }},
+		{configMaxNodeName, "at most", func(value float64, limit float64) bool { return value <= limit }},
+	}
+
+	for _, bound := range bounds {
+		limitTag, ok := field.Tag.Lookup(bound.tag)
+		if !ok {
+			continue
+		}
+
+		limit, err := strconv.ParseFloat(limitTag, 64)
+		if err != nil {
+			return fmt.Errorf("invalid '%s' tag: %s", bound.tag, err)
+		}
+
+		value, isNumber := nodeData.(float64)
+		if !isNumber {
+			return fmt.Errorf("'%s' tag requires a number, got: %T", bound.tag, nodeData)
+		}
+
+		if !bound.inBounds(value, limit) {
+			return fmt.Errorf("expected a value %s %s, got: %v", bound.description, limitTag, value)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,212 @@
+package kmsconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"sort"
+)
+
+type (
+	// fileMember a member of a JSON object in a config file, in the order it
+	// appears in the file.
+	fileMember struct {
+		key   string
+		value json.RawMessage
+	}
+)
+
+// encodeFile encodes data as an environment file. Sections, nodes and
+// fields keep the order they have in original, the file as it was read, and
+// unchanged values keep their original bytes, so saving a change only
+// touches the nodes that changed. New sections and nodes are added in
+// alphabetical order, and new fields after "value" and "secure". If nothing
+// changed, original is returned as it is.
+func encodeFile(original []byte, data map[string]map[string]map[string]interface{}) ([]byte, error) {
+	var originalData map[string]map[string]map[string]interface{}
+	if json.Unmarshal(original, &originalData) == nil && reflect.DeepEqual(originalData, data) {
+		return original, nil
+	}
+
+	originalSections, _ := decodeMembers(original)
+
+	var buffer bytes.Buffer
+	err := encodeObject(&buffer, originalSections, slices.Collect(maps.Keys(data)), sort.Strings, func(sectionKey string, originalSection json.RawMessage) error {
+		originalNodes, _ := decodeMembers(originalSection)
+		section := data[sectionKey]
+
+		return encodeObject(&buffer, originalNodes, slices.Collect(maps.Keys(section)), sort.Strings, func(nodeKey string, originalNode json.RawMessage) error {
+			originalFields, _ := decodeMembers(originalNode)
+			node := section[nodeKey]
+
+			return encodeObject(&buffer, originalFields, slices.Collect(maps.Keys(node)), sortFields, func(field string, originalValue json.RawMessage) error {
+				if unchangedValue(originalValue, node[field]) {
+					return json.Compact(&buffer, originalValue)
+				}
+
+				encodedValue, err := encodeValue(node[field])
+				if err != nil {
+					return fmt.Errorf("error encoding %s.%s: %w", sectionKey, nodeKey, err)
+				}
+
+				buffer.Write(encodedValue)
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var indented bytes.Buffer
+	err = json.Indent(&indented, buffer.Bytes(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	indented.WriteByte('\n')
+	return indented.Bytes(), nil
+}
+
+// encodeObject writes a JSON object with the given keys, in the order they
+// appear in original followed by the rest sorted by sortKeys, calling
+// encodeMember to write the value of each key.
+func encodeObject(buffer *bytes.Buffer, original []fileMember, keys []string, sortKeys func([]string), encodeMember func(key string, original json.RawMessage) error) error {
+	remaining := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		remaining[key] = true
+	}
+
+	var ordered []string
+	originalValues := make(map[string]json.RawMessage, len(original))
+	for _, member := range original {
+		if remaining[member.key] {
+			ordered = append(ordered, member.key)
+			originalValues[member.key] = member.value
+			delete(remaining, member.key)
+		}
+	}
+
+	added := make([]string, 0, len(remaining))
+	for _, key := range keys {
+		if remaining[key] {
+			added = append(added, key)
+		}
+	}
+	sortKeys(added)
+
+	buffer.WriteByte('{')
+	for i, key := range append(ordered, added...) {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+
+		encodedKey, err := encodeValue(key)
+		if err != nil {
+			return err
+		}
+
+		buffer.Write(encodedKey)
+		buffer.WriteByte(':')
+
+		err = encodeMember(key, originalValues[key])
+		if err != nil {
+			return err
+		}
+	}
+	buffer.WriteByte('}')
+
+	return nil
+}
+
+// unchangedValue reports whether original, the bytes of a value as read,
+// still decodes to value. Numbers compare as decoded, so a large integer
+// that can't be represented exactly keeps its original digits.
+func unchangedValue(original json.RawMessage, value interface{}) bool {
+	if original == nil {
+		return false
+	}
+
+	var originalValue interface{}
+	if json.Unmarshal(original, &originalValue) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(originalValue, value)
+}
+
+// decodeMembers returns the members of a JSON object in the order they
+// appear, or nothing if contents isn't an object.
+func decodeMembers(contents []byte) ([]fileMember, error) {
+	if len(bytes.TrimSpace(contents)) == 0 {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("expected a JSON object")
+	}
+
+	var members []fileMember
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		var value json.RawMessage
+		err = decoder.Decode(&value)
+		if err != nil {
+			return nil, err
+		}
+
+		members = append(members, fileMember{token.(string), value})
+	}
+
+	return members, nil
+}
+
+// sortFields orders node fields as the file format documents them: value,
+// then secure, then any others alphabetically.
+func sortFields(fields []string) {
+	rank := func(field string) int {
+		switch field {
+		case valueFieldName:
+			return 0
+		case secureFieldName:
+			return 1
+		default:
+			return 2
+		}
+	}
+
+	sort.Slice(fields, func(i, j int) bool {
+		if rank(fields[i]) != rank(fields[j]) {
+			return rank(fields[i]) < rank(fields[j])
+		}
+
+		return fields[i] < fields[j]
+	})
+}
+
+// encodeValue encodes a value without HTML escaping, as encodeJSON does.
+func encodeValue(value interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+
+	err := encoder.Encode(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,219 @@
+package kmsconfig
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	durationSuffixes = []struct {
+		suffix       string
+		durationType string
+	}{
+		{"_microseconds", "microseconds"},
+		{"_us", "microseconds"},
+		{"_milliseconds", "milliseconds"},
+		{"_ms", "milliseconds"},
+		{"_seconds", "seconds"},
+		{"_secs", "seconds"},
+		{"_minutes", "minutes"},
+		{"_mins", "minutes"},
+		{"_hours", "hours"},
+		{"_days", "days"},
+	}
+
+	commonInitialisms = map[string]bool{
+		"ACL": true, "API": true, "ARN": true, "AWS": true, "CPU": true,
+		"DB": true, "DNS": true, "HTML": true, "HTTP": true, "HTTPS": true,
+		"ID": true, "IP": true, "JSON": true, "JWT": true, "KMS": true,
+		"SNS": true, "SQL": true, "SQS": true, "SSH": true, "SSL": true,
+		"TLS": true, "TTL": true, "URI": true, "URL": true, "UUID": true,
+		"XML": true,
+	}
+)
+
+type (
+	generatedField struct {
+		name      string
+		fieldType string
+		tags      string
+	}
+)
+
+// GenerateStruct generates Go source for a struct that Populate can fill
+// from the environment file read into c, with a nested struct for each
+// section. Field types are inferred from the stored values: arrays of
+// strings become string slices and other arrays []interface{}, whole
+// numbers with a duration suffix such as _seconds or _ms become
+// time.Duration fields, and secure nodes become Secret fields.
+func GenerateStruct(c *Config, packageName string, typeName string) ([]byte, error) {
+	var sectionTypes bytes.Buffer
+	data := c.Snapshot().data
+	rootFields := make([]generatedField, 0, len(data))
+	imports := make(map[string]bool)
+	typeNames := map[string]bool{typeName: true}
+	rootFieldNames := make(map[string]bool)
+
+	for _, sectionKey := range unionKeys(data, nil) {
+		sectionTypeName := goIdentifier(sectionKey) + "Section"
+		for i := 2; typeNames[sectionTypeName]; i++ {
+			sectionTypeName = goIdentifier(sectionKey) + "Section" + strconv.Itoa(i)
+		}
+		typeNames[sectionTypeName] = true
+
+		rootFieldName := goIdentifier(sectionKey)
+		for i := 2; rootFieldNames[rootFieldName]; i++ {
+			rootFieldName = goIdentifier(sectionKey) + strconv.Itoa(i)
+		}
+		rootFieldNames[rootFieldName] = true
+
+		rootFields = append(rootFields, generatedField{
+			rootFieldName,
+			sectionTypeName,
+			fmt.Sprintf(`config:"%s"`, sectionKey),
+		})
+
+		fieldNames := make(map[string]bool)
+		var fields []generatedField
+
+		for _, nodeKey := range unionKeys(data[sectionKey], nil) {
+			field := generateField(nodeKey, data[sectionKey][nodeKey], imports)
+			if fieldNames[field.name] {
+				field.name = goIdentifier(nodeKey)
+			}
+
+			name := field.name
+			for i := 2; fieldNames[field.name]; i++ {
+				field.name = name + strconv.Itoa(i)
+			}
+
+			fieldNames[field.name] = true
+			fields = append(fields, field)
+		}
+
+		writeStruct(&sectionTypes, sectionTypeName, "", fields)
+	}
+
+	var source bytes.Buffer
+	fmt.Fprintf(&source, "// Generated by kmsconfig gen from %s.json.\n\n", c.Env)
+	fmt.Fprintf(&source, "package %s\n\n", packageName)
+
+	if len(imports) > 0 {
+		source.WriteString("import (\n")
+		if imports["time"] {
+			source.WriteString("\"time\"\n\n")
+			delete(imports, "time")
+		}
+		for _, importPath := range unionKeys(imports, nil) {
+			fmt.Fprintf(&source, "%q\n", importPath)
+		}
+		source.WriteString(")\n\n")
+	}
+
+	source.WriteString("type (\n")
+	writeStruct(&source, typeName, fmt.Sprintf("%s is the config stored in %s.json.", typeName, c.Env), rootFields)
+	source.Write(sectionTypes.Bytes())
+	source.WriteString(")\n")
+
+	return format.Source(source.Bytes())
+}
+
+func generateField(nodeKey string, nodeValue map[string]interface{}, imports map[string]bool) generatedField {
+	field := generatedField{
+		goIdentifier(nodeKey),
+		"interface{}",
+		fmt.Sprintf(`config:"%s"`, nodeKey),
+	}
+
+	if secure, _ := nodeValue[secureFieldName].(bool); secure {
+		imports[reflect.TypeOf(Secret("")).PkgPath()] = true
+		field.fieldType = "kmsconfig.Secret"
+		field.tags += ` config_secure:"true"`
+		return field
+	}
+
+	if isReference(nodeValue) {
+		field.fieldType = "string"
+		return field
+	}
+
+	switch value := nodeValue[valueFieldName].(type) {
+	case string:
+		field.fieldType = "string"
+	case bool:
+		field.fieldType = "bool"
+	case []interface{}:
+		field.fieldType = "[]string"
+		for _, item := range value {
+			if _, isString := item.(string); !isString {
+				field.fieldType = "[]interface{}"
+				break
+			}
+		}
+	case map[string]interface{}:
+		field.fieldType = "map[string]interface{}"
+	case float64:
+		if value != math.Trunc(value) {
+			field.fieldType = "float64"
+			break
+		}
+
+		field.fieldType = "int64"
+		for _, duration := range durationSuffixes {
+			if strings.HasSuffix(nodeKey, duration.suffix) && nodeKey != duration.suffix[1:] {
+				imports["time"] = true
+				field.name = goIdentifier(strings.TrimSuffix(nodeKey, duration.suffix))
+				field.fieldType = "time.Duration"
+				field.tags += fmt.Sprintf(` config_duration_type:"%s"`, duration.durationType)
+				break
+			}
+		}
+	}
+
+	return field
+}
+
+func writeStruct(source *bytes.Buffer, name string, comment string, fields []generatedField) {
+	if comment != "" {
+		fmt.Fprintf(source, "// %s\n", comment)
+	}
+
+	fmt.Fprintf(source, "%s struct {\n", name)
+	for _, field := range fields {
+		fmt.Fprintf(source, "%s %s `%s`\n", field.name, field.fieldType, field.tags)
+	}
+	source.WriteString("}\n\n")
+}
+
+// goIdentifier converts a snake_case config key into an exported Go
+// identifier, upper casing common initialisms such as ID and URL.
+func goIdentifier(key string) string {
+	words := strings.FieldsFunc(key, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var identifier strings.Builder
+	for _, word := range words {
+		upperWord := strings.ToUpper(word)
+		if commonInitialisms[upperWord] {
+			identifier.WriteString(upperWord)
+			continue
+		}
+
+		runes := []rune(word)
+		identifier.WriteString(strings.ToUpper(string(runes[0])) + string(runes[1:]))
+	}
+
+	name := identifier.String()
+	if name == "" || !unicode.IsLetter([]rune(name)[0]) {
+		name = "Field" + name
+	}
+
+	return name
+}
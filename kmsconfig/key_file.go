@@ -0,0 +1,272 @@
+package kmsconfig
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+)
+
+const (
+	ageSecretKeyPrefix = "AGE-SECRET-KEY-"
+	aesGCMLocation     = "aes-gcm"
+	ageLocation        = "age"
+)
+
+type (
+	// AESGCMKey encrypts and decrypts secure values offline with a 256 bit
+	// AES-GCM key. Ciphertext is the base64 encoded nonce followed by the
+	// sealed plaintext.
+	AESGCMKey struct {
+		aead cipher.AEAD
+	}
+
+	// AgeKey encrypts and decrypts secure values offline with age X25519
+	// identities. Ciphertext is the base64 encoded binary age format.
+	AgeKey struct {
+		identities []age.Identity
+		recipient  age.Recipient
+	}
+
+	// failingDecrypter returns the error from loading a key file, so that it
+	// surfaces for each secure value like any other decrypt error.
+	failingDecrypter struct {
+		err error
+	}
+)
+
+// LoadKeyFile reads a key file for decrypting secure values offline. A
+// file with age identities, as written by age-keygen, gives an AgeKey, and
+// any other file is read as a base64 encoded AES-GCM key.
+func LoadKeyFile(path string) (Decrypter, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Contains(contents, []byte(ageSecretKeyPrefix)) {
+		return NewAgeKey(string(contents))
+	}
+
+	return NewAESGCMKey(strings.TrimSpace(string(contents)))
+}
+
+// NewAESGCMKey creates an AESGCMKey from a base64 encoded 32 byte key.
+func NewAESGCMKey(encodedKey string) (*AESGCMKey, error) {
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not base64 decode AES-GCM key: %w", err)
+	}
+
+	return newAESGCMKey(key)
+}
+
+func newAESGCMKey(key []byte) (*AESGCMKey, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("AES-GCM key must be 32 bytes, got %d", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AESGCMKey{aead}, nil
+}
+
+func (k *AESGCMKey) String() string {
+	return aesGCMLocation
+}
+
+// Decrypt opens ciphertext sealed by Encrypt.
+func (k *AESGCMKey) Decrypt(ciphertext string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("could not base64 decode secure value: %w", err)
+	}
+
+	nonceSize := k.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return "", fmt.Errorf("AES-GCM ciphertext is too short")
+	}
+
+	plaintext, err := k.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt AES-GCM ciphertext: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+// Encrypt seals the plaintext under a random nonce. There is only one key,
+// so keyID is ignored.
+func (k *AESGCMKey) Encrypt(keyID string, plaintext string) (string, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+
+	sealed := k.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// NewAgeKey creates an AgeKey from the contents of an age identity file.
+// Values are encrypted to the first identity's recipient by default.
+func NewAgeKey(identityFile string) (*AgeKey, error) {
+	identities, err := age.ParseIdentities(strings.NewReader(identityFile))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse age identities: %w", err)
+	}
+
+	key := &AgeKey{identities: identities}
+	if identity, ok := identities[0].(*age.X25519Identity); ok {
+		key.recipient = identity.Recipient()
+	}
+
+	return key, nil
+}
+
+func (k *AgeKey) String() string {
+	return ageLocation
+}
+
+// Decrypt decrypts ciphertext encrypted to any of the identities.
+func (k *AgeKey) Decrypt(ciphertext string) (string, error) {
+	encrypted, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("could not base64 decode secure value: %w", err)
+	}
+
+	reader, err := age.Decrypt(bytes.NewReader(encrypted), k.identities...)
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt age ciphertext: %w", err)
+	}
+
+	plaintext, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// Encrypt encrypts the plaintext to the age recipient keyID, or to the
+// first identity when keyID is empty.
+func (k *AgeKey) Encrypt(keyID string, plaintext string) (string, error) {
+	recipient := k.recipient
+	if keyID != "" {
+		var err error
+		recipient, err = age.ParseX25519Recipient(keyID)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if recipient == nil {
+		return "", fmt.Errorf("an age recipient is required to encrypt")
+	}
+
+	var encrypted bytes.Buffer
+	writer, err := age.Encrypt(&encrypted, recipient)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.WriteString(writer, plaintext)
+	if err != nil {
+		return "", err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(encrypted.Bytes()), nil
+}
+
+func (d failingDecrypter) Decrypt(string) (string, error) {
+	return "", d.err
+}
+
+func (d failingDecrypter) Encrypt(string, string) (string, error) {
+	return "", d.err
+}
+
+// keyFileDecrypter returns the key file set in KeyFiles for the
+// environment, resolving relative paths against the config path. Key files
+// are loaded once and reused until the config is loaded again.
+func (c Config) keyFileDecrypter() (Decrypter, bool) {
+	keyFile, ok := c.keyFilePath()
+	if !ok {
+		return nil, false
+	}
+
+	if c.shared == nil {
+		return c.loadKeyFile(keyFile), true
+	}
+
+	c.shared.keyFileMutex.Lock()
+	defer c.shared.keyFileMutex.Unlock()
+
+	decrypter, ok := c.shared.keyFiles[keyFile]
+	if !ok {
+		decrypter = c.loadKeyFile(keyFile)
+		if c.shared.keyFiles == nil {
+			c.shared.keyFiles = make(map[string]Decrypter)
+		}
+		c.shared.keyFiles[keyFile] = decrypter
+	}
+
+	return decrypter, true
+}
+
+// keyFilePath returns the path of the key file set in KeyFiles for the
+// environment, resolved against the config path if it's relative.
+func (c Config) keyFilePath() (string, bool) {
+	keyFile, ok := c.KeyFiles[c.Env]
+	if !ok {
+		return "", false
+	}
+
+	if !filepath.IsAbs(keyFile) {
+		keyFile = filepath.Join(c.Path, keyFile)
+	}
+
+	return keyFile, true
+}
+
+func (c Config) loadKeyFile(keyFile string) Decrypter {
+	decrypter, err := LoadKeyFile(keyFile)
+	if err != nil {
+		return failingDecrypter{fmt.Errorf("error loading key file for %s: %w", c.Env, err)}
+	}
+
+	return decrypter
+}
+
+// forgetKeyFiles drops loaded key files, so that loading the config picks
+// up key files that changed.
+func (c Config) forgetKeyFiles() {
+	if c.shared == nil {
+		return
+	}
+
+	c.shared.keyFileMutex.Lock()
+	c.shared.keyFiles = nil
+	c.shared.keyFileMutex.Unlock()
+}
@@ -0,0 +1,77 @@
+package kmsconfig
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+type (
+	// KMSOptions configures the KMS client built by NewKMSWrapperWithOptions.
+	// Empty fields fall back to the default AWS config: environment
+	// variables, shared config files and instance roles.
+	KMSOptions struct {
+		// Region the KMS client talks to, e.g. "eu-west-1".
+		Region string
+		// Endpoint overrides the AWS endpoint, e.g. for a local KMS
+		// stand-in. It's used for STS too when assuming a role.
+		Endpoint string
+		// Profile is the shared config profile to load credentials and
+		// region from.
+		Profile string
+		// RoleARN is a role to assume with STS before calling KMS, with
+		// ExternalID and RoleSessionName passed to AssumeRole if set.
+		RoleARN         string
+		ExternalID      string
+		RoleSessionName string
+		// GrantTokens are sent with every KMS request, for keys accessed
+		// through grants that haven't propagated yet.
+		GrantTokens []string
+	}
+)
+
+// NewKMSWrapperWithOptions returns a KMSWrapper with a KMS client for the
+// given options.
+func NewKMSWrapperWithOptions(options KMSOptions) (KMSWrapper, error) {
+	var loadOptions []func(*awsconfig.LoadOptions) error
+	if options.Region != "" {
+		loadOptions = append(loadOptions, awsconfig.WithRegion(options.Region))
+	}
+
+	if options.Endpoint != "" {
+		loadOptions = append(loadOptions, awsconfig.WithBaseEndpoint(options.Endpoint))
+	}
+
+	if options.Profile != "" {
+		loadOptions = append(loadOptions, awsconfig.WithSharedConfigProfile(options.Profile))
+	}
+
+	awsConfig, err := awsconfig.LoadDefaultConfig(context.Background(), loadOptions...)
+	if err != nil {
+		return KMSWrapper{}, fmt.Errorf("error loading AWS config for KMS: %w", err)
+	}
+
+	if options.RoleARN != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(awsConfig), options.RoleARN, func(assumeRoleOptions *stscreds.AssumeRoleOptions) {
+			if options.ExternalID != "" {
+				assumeRoleOptions.ExternalID = aws.String(options.ExternalID)
+			}
+
+			if options.RoleSessionName != "" {
+				assumeRoleOptions.RoleSessionName = options.RoleSessionName
+			}
+		})
+
+		awsConfig.Credentials = aws.NewCredentialsCache(provider)
+	}
+
+	return KMSWrapper{
+		Client:      kms.NewFromConfig(awsConfig),
+		GrantTokens: options.GrantTokens,
+	}, nil
+}
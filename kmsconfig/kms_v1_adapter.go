@@ -0,0 +1,109 @@
+package kmsconfig
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go/aws"
+	kmsv1 "github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+)
+
+type (
+	// KMSV1Adapter lets an aws-sdk-go v1 KMS client be used as a
+	// KMSWrapper's Client, for services that haven't moved to
+	// aws-sdk-go-v2 yet. It calls the client's WithContext methods.
+	//
+	// Deprecated: use a *kms.Client from aws-sdk-go-v2. The adapter will be
+	// removed in the next major version.
+	KMSV1Adapter struct {
+		Client kmsiface.KMSAPI
+	}
+)
+
+// NewKMSV1Adapter returns a KMSV1Adapter for a v1 KMS client.
+//
+// Deprecated: use a *kms.Client from aws-sdk-go-v2.
+func NewKMSV1Adapter(client kmsiface.KMSAPI) KMSV1Adapter {
+	return KMSV1Adapter{Client: client}
+}
+
+// Decrypt calls DecryptWithContext on the v1 client.
+func (a KMSV1Adapter) Decrypt(ctx context.Context, params *kms.DecryptInput, _ ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	output, err := a.Client.DecryptWithContext(ctx, &kmsv1.DecryptInput{
+		CiphertextBlob:    params.CiphertextBlob,
+		EncryptionContext: v1StringMap(params.EncryptionContext),
+		GrantTokens:       v1StringSlice(params.GrantTokens),
+		KeyId:             params.KeyId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &kms.DecryptOutput{
+		KeyId:     output.KeyId,
+		Plaintext: output.Plaintext,
+	}, nil
+}
+
+// Encrypt calls EncryptWithContext on the v1 client.
+func (a KMSV1Adapter) Encrypt(ctx context.Context, params *kms.EncryptInput, _ ...func(*kms.Options)) (*kms.EncryptOutput, error) {
+	output, err := a.Client.EncryptWithContext(ctx, &kmsv1.EncryptInput{
+		EncryptionContext: v1StringMap(params.EncryptionContext),
+		GrantTokens:       v1StringSlice(params.GrantTokens),
+		KeyId:             params.KeyId,
+		Plaintext:         params.Plaintext,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &kms.EncryptOutput{
+		CiphertextBlob: output.CiphertextBlob,
+		KeyId:          output.KeyId,
+	}, nil
+}
+
+// GenerateDataKey calls GenerateDataKeyWithContext on the v1 client.
+func (a KMSV1Adapter) GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, _ ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error) {
+	input := &kmsv1.GenerateDataKeyInput{
+		EncryptionContext: v1StringMap(params.EncryptionContext),
+		GrantTokens:       v1StringSlice(params.GrantTokens),
+		KeyId:             params.KeyId,
+	}
+
+	if params.NumberOfBytes != nil {
+		input.NumberOfBytes = aws.Int64(int64(*params.NumberOfBytes))
+	}
+
+	if params.KeySpec != "" {
+		input.KeySpec = aws.String(string(params.KeySpec))
+	}
+
+	output, err := a.Client.GenerateDataKeyWithContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kms.GenerateDataKeyOutput{
+		CiphertextBlob: output.CiphertextBlob,
+		KeyId:          output.KeyId,
+		Plaintext:      output.Plaintext,
+	}, nil
+}
+
+func v1StringMap(values map[string]string) map[string]*string {
+	if len(values) == 0 {
+		return nil
+	}
+
+	return aws.StringMap(values)
+}
+
+func v1StringSlice(values []string) []*string {
+	if len(values) == 0 {
+		return nil
+	}
+
+	return aws.StringSlice(values)
+}
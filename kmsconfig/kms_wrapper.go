@@ -1,46 +1,218 @@
 package kmsconfig
 
 import (
+	"context"
 	"encoding/base64"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/kms"
-	"log"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
 )
 
 type (
-	// KMSWrapper comment pending
+	// Decrypter decrypts the ciphertext of secure values. KMSWrapper and
+	// VaultClient are Decrypters.
+	Decrypter interface {
+		Decrypt(ciphertext string) (string, error)
+	}
+
+	// ContextDecrypter is a Decrypter whose calls can be cancelled, or given
+	// a deadline, with a context. LoadContext and ReloadContext decrypt with
+	// DecryptContext when a decrypter has it. KMSWrapper is a
+	// ContextDecrypter.
+	ContextDecrypter interface {
+		Decrypter
+		DecryptContext(ctx context.Context, ciphertext string) (string, error)
+	}
+
+	// Encrypter encrypts plaintext into the ciphertext of a secure value,
+	// under a key whose ID means whatever it does to the Encrypter.
+	Encrypter interface {
+		Encrypt(keyID string, plaintext string) (string, error)
+	}
+
+	// KMSAPI the KMS operations KMSWrapper uses. *kms.Client from
+	// aws-sdk-go-v2 implements it, as does KMSV1Adapter for aws-sdk-go v1
+	// clients.
+	KMSAPI interface {
+		Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+		Encrypt(ctx context.Context, params *kms.EncryptInput, optFns ...func(*kms.Options)) (*kms.EncryptOutput, error)
+		GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error)
+	}
+
+	// KMSWrapper decrypts and encrypts secure values with AWS KMS.
 	KMSWrapper struct {
-		Client *kms.KMS
+		// Client calls KMS, defaulting to a client for the default AWS
+		// config when nil.
+		Client KMSAPI
+		// EncryptionContext is sent with every encrypt and decrypt, so
+		// ciphertext only decrypts with the context it was encrypted with.
+		EncryptionContext map[string]string
+		// AllowedKeyIDs, when set, rejects values encrypted under any other
+		// key. Keys are given as key IDs or ARNs.
+		AllowedKeyIDs []string
+		// Envelope encrypts every value with a data key, rather than only
+		// values over the KMS limit.
+		Envelope bool
+		// GrantTokens are sent with every KMS request.
+		GrantTokens []string
 	}
 )
 
-// NewKMSWrapper comment pending
-func NewKMSWrapper() KMSWrapper {
-	return KMSWrapper{
-		kms.New(session.New()),
+// defaultAWSConfig loads the default AWS config once, for the clients used
+// when none is set.
+var defaultAWSConfig = sync.OnceValues(func() (aws.Config, error) {
+	return awsconfig.LoadDefaultConfig(context.Background())
+})
+
+// defaultKMSClient creates a client for the default AWS config once, the
+// first time a KMSWrapper without a Client is used.
+var defaultKMSClient = sync.OnceValues(func() (KMSAPI, error) {
+	awsConfig, err := defaultAWSConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error loading default AWS config for KMS: %w", err)
 	}
+
+	return kms.NewFromConfig(awsConfig), nil
+})
+
+// NewKMSWrapper returns a KMSWrapper using the default AWS config, loaded
+// from the environment, shared config files or instance role on first use.
+func NewKMSWrapper() KMSWrapper {
+	return KMSWrapper{}
 }
 
-// Decrypt comment pending
+func (k KMSWrapper) String() string {
+	return kmsLocation
+}
+
+// Decrypt decrypts a secure value, either base64 encoded KMS ciphertext or
+// an envelope encrypted value, with the EncryptionContext, rejecting values
+// encrypted under a key that isn't one of the AllowedKeyIDs.
 func (k KMSWrapper) Decrypt(encodedCipherTextBlob string) (string, error) {
+	return k.DecryptContext(context.Background(), encodedCipherTextBlob)
+}
+
+// DecryptContext decrypts a secure value like Decrypt, cancelling the KMS
+// request with ctx.
+func (k KMSWrapper) DecryptContext(ctx context.Context, encodedCipherTextBlob string) (string, error) {
+	plaintext, _, err := k.decryptWithKeyID(ctx, encodedCipherTextBlob)
+	return plaintext, err
+}
+
+// decryptWithKeyID decrypts the value and also returns the ARN of the key
+// it was encrypted under, so it can be re-encrypted under the same key.
+func (k KMSWrapper) decryptWithKeyID(ctx context.Context, encodedCipherTextBlob string) (string, string, error) {
+	if envelope, ok := strings.CutPrefix(encodedCipherTextBlob, envelopePrefix); ok {
+		return k.decryptEnvelope(ctx, envelope)
+	}
+
 	decodedValue, err := base64.StdEncoding.DecodeString(encodedCipherTextBlob)
 
 	if err != nil {
-		log.Printf("Could not Base64 decode: '%s'", encodedCipherTextBlob)
-		return "", err
+		return "", "", fmt.Errorf("could not base64 decode secure value: %w", err)
+	}
+
+	plaintext, keyID, err := k.decryptBlob(ctx, decodedValue)
+	if err != nil {
+		return "", "", err
+	}
+
+	return string(plaintext), keyID, nil
+}
+
+// decryptBlob decrypts a ciphertext blob with KMS, checking the key it was
+// encrypted under is allowed.
+func (k KMSWrapper) decryptBlob(ctx context.Context, cipherTextBlob []byte) ([]byte, string, error) {
+	client, err := k.client()
+	if err != nil {
+		return nil, "", err
+	}
+
+	output, err := client.Decrypt(ctx, k.decryptParmas(cipherTextBlob))
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	keyID := aws.ToString(output.KeyId)
+	if !k.keyAllowed(keyID) {
+		return nil, "", fmt.Errorf("secure value is encrypted under key '%s', which isn't allowed", keyID)
 	}
 
-	output, err := k.Client.Decrypt(k.decryptParmas(decodedValue))
+	return output.Plaintext, keyID, nil
+}
+
+// Encrypt encrypts the plaintext under the given KMS key ID, alias or ARN
+// and returns the base64 encoded ciphertext, ready to be stored in a config
+// file as a secure value. Values over the KMS limit, or every value if
+// Envelope is set, are envelope encrypted.
+func (k KMSWrapper) Encrypt(keyID string, plaintext string) (string, error) {
+	return k.EncryptContext(context.Background(), keyID, plaintext)
+}
+
+// EncryptContext encrypts a value like Encrypt, cancelling the KMS request
+// with ctx.
+func (k KMSWrapper) EncryptContext(ctx context.Context, keyID string, plaintext string) (string, error) {
+	if k.Envelope || len(plaintext) > kmsMaxPlaintextSize {
+		return k.encryptEnvelope(ctx, keyID, plaintext)
+	}
+
+	client, err := k.client()
+	if err != nil {
+		return "", err
+	}
 
+	output, err := client.Encrypt(ctx, k.encryptParams(keyID, []byte(plaintext)))
 	if err != nil {
 		return "", err
 	}
 
-	return string(output.Plaintext[:]), nil
+	return base64.StdEncoding.EncodeToString(output.CiphertextBlob), nil
+}
+
+// client returns the Client, or the client for the default AWS config if
+// it isn't set.
+func (k KMSWrapper) client() (KMSAPI, error) {
+	if k.Client == nil {
+		return defaultKMSClient()
+	}
+
+	return k.Client, nil
+}
+
+// keyAllowed reports whether the key ARN KMS decrypted with is one of the
+// AllowedKeyIDs, or if any key is allowed.
+func (k KMSWrapper) keyAllowed(keyARN string) bool {
+	if len(k.AllowedKeyIDs) == 0 {
+		return true
+	}
+
+	for _, allowedKeyID := range k.AllowedKeyIDs {
+		if keyARN == allowedKeyID || strings.HasSuffix(keyARN, ":key/"+allowedKeyID) {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (k KMSWrapper) decryptParmas(cipherTextBlob []byte) *kms.DecryptInput {
 	return &kms.DecryptInput{
-		CiphertextBlob: cipherTextBlob,
+		CiphertextBlob:    cipherTextBlob,
+		EncryptionContext: k.EncryptionContext,
+		GrantTokens:       k.GrantTokens,
+	}
+}
+
+func (k KMSWrapper) encryptParams(keyID string, plaintext []byte) *kms.EncryptInput {
+	return &kms.EncryptInput{
+		EncryptionContext: k.EncryptionContext,
+		GrantTokens:       k.GrantTokens,
+		KeyId:             aws.String(keyID),
+		Plaintext:         plaintext,
 	}
 }
@@ -1,7 +1,98 @@
 package kmsconfig
 
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
 type (
 	// LogHandler function that is called when lib
 	// needs to log an action.
 	LogHandler func(string)
+
+	// logHandlerAdapter passes slog records to a LogHandler as a single
+	// line, with attributes appended as key=value pairs.
+	logHandlerAdapter struct {
+		logHandler LogHandler
+		attrs      []slog.Attr
+		group      string
+	}
 )
+
+// Handler adapts the LogHandler to an slog.Handler. Records of every level
+// are passed on, formatted as the message followed by key=value attributes.
+func (l LogHandler) Handler() slog.Handler {
+	return logHandlerAdapter{logHandler: l}
+}
+
+func (a logHandlerAdapter) Enabled(context.Context, slog.Level) bool {
+	return a.logHandler != nil
+}
+
+func (a logHandlerAdapter) Handle(_ context.Context, record slog.Record) error {
+	var message strings.Builder
+	message.WriteString(record.Message)
+
+	for _, attr := range a.attrs {
+		writeAttr(&message, "", attr)
+	}
+
+	record.Attrs(func(attr slog.Attr) bool {
+		writeAttr(&message, a.group, attr)
+		return true
+	})
+
+	a.logHandler(message.String())
+	return nil
+}
+
+func (a logHandlerAdapter) WithAttrs(attrs []slog.Attr) slog.Handler {
+	prefixed := make([]slog.Attr, len(a.attrs), len(a.attrs)+len(attrs))
+	copy(prefixed, a.attrs)
+	for _, attr := range attrs {
+		attr.Key = a.group + attr.Key
+		prefixed = append(prefixed, attr)
+	}
+
+	a.attrs = prefixed
+	return a
+}
+
+func (a logHandlerAdapter) WithGroup(name string) slog.Handler {
+	if name != "" {
+		a.group += name + "."
+	}
+
+	return a
+}
+
+func writeAttr(message *strings.Builder, prefix string, attr slog.Attr) {
+	value := attr.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+
+		for _, groupAttr := range value.Group() {
+			writeAttr(message, prefix, groupAttr)
+		}
+		return
+	}
+
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	fmt.Fprintf(message, " %s%s=%s", prefix, attr.Key, value)
+}
+
+// logger returns the Logger, or one that discards records if it isn't set.
+func (c Config) logger() *slog.Logger {
+	if c.Logger == nil {
+		return slog.New(LogHandler(nil).Handler())
+	}
+
+	return c.Logger
+}
@@ -0,0 +1,26 @@
+package kmsconfig_test
+
+import (
+	"context"
+
+	"github.com/vidsy/go-kmsconfig/v6/kmsconfig"
+)
+
+// memoryObserver records the events it observes.
+type memoryObserver struct {
+	loads    []kmsconfig.LoadEvent
+	decrypts []kmsconfig.DecryptEvent
+	reloads  []kmsconfig.ReloadEvent
+}
+
+func (o *memoryObserver) ObserveLoad(_ context.Context, event kmsconfig.LoadEvent) {
+	o.loads = append(o.loads, event)
+}
+
+func (o *memoryObserver) ObserveDecrypt(_ context.Context, event kmsconfig.DecryptEvent) {
+	o.decrypts = append(o.decrypts, event)
+}
+
+func (o *memoryObserver) ObserveReload(_ context.Context, event kmsconfig.ReloadEvent) {
+	o.reloads = append(o.reloads, event)
+}
@@ -0,0 +1,82 @@
+package kmsconfig
+
+import (
+	"context"
+	"time"
+)
+
+type (
+	// Observer is notified of loads, decryptions and reloads, so that they
+	// can be reported as metrics or traces. Methods are called synchronously
+	// with the context passed to LoadContext or ReloadContext, and must not
+	// block.
+	Observer interface {
+		ObserveLoad(context.Context, LoadEvent)
+		ObserveDecrypt(context.Context, DecryptEvent)
+		ObserveReload(context.Context, ReloadEvent)
+	}
+
+	// LoadEvent describes a load of an environment. Decrypted counts the
+	// secure nodes decrypted, of which CacheHits came from the decrypt cache.
+	LoadEvent struct {
+		Env       string
+		Duration  time.Duration
+		Decrypted int
+		CacheHits int
+		Err       error
+	}
+
+	// DecryptEvent describes the decryption of a single secure node. Duration
+	// is the latency of the KMS call, and is zero for cache hits.
+	DecryptEvent struct {
+		Section  string
+		Key      string
+		Duration time.Duration
+		CacheHit bool
+		Err      error
+	}
+
+	// ReloadEvent describes a reload, which failed if Err is set.
+	ReloadEvent struct {
+		Env      string
+		Duration time.Duration
+		Err      error
+	}
+
+	noopObserver struct{}
+)
+
+func (noopObserver) ObserveLoad(context.Context, LoadEvent)       {}
+func (noopObserver) ObserveDecrypt(context.Context, DecryptEvent) {}
+func (noopObserver) ObserveReload(context.Context, ReloadEvent)   {}
+
+// observer returns the Observer, or one that ignores events if it isn't set.
+func (c Config) observer() Observer {
+	if c.Observer == nil {
+		return noopObserver{}
+	}
+
+	return c.Observer
+}
+
+// countDecrypted counts the secure nodes that were decrypted, and how many
+// of them came from the decrypt cache.
+func countDecrypted(sections map[string]ConfigSection) (int, int) {
+	var decrypted, cacheHits int
+	for _, section := range sections {
+		for _, node := range section.Nodes {
+			for _, source := range node.Sources {
+				if source.Kind != SourceDecrypted {
+					continue
+				}
+
+				decrypted++
+				if source.Location == decryptCacheLocation {
+					cacheHits++
+				}
+			}
+		}
+	}
+
+	return decrypted, cacheHits
+}
@@ -0,0 +1,150 @@
+// Package otelobserver reports kmsconfig loads, decryptions and reloads as
+// OpenTelemetry metrics and spans.
+//
+// Spans are children of the span in the context passed to LoadContext or
+// ReloadContext, and roots when there isn't one. Load and Reload use
+// context.Background. Decrypt spans are recorded as they finish, before the
+// load they happened in, so they are siblings of its span rather than
+// children, falling within its start and end times.
+package otelobserver
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/vidsy/go-kmsconfig/v6/kmsconfig"
+)
+
+const instrumentationName = "github.com/vidsy/go-kmsconfig/v6/kmsconfig/otelobserver"
+
+type (
+	// Observer is a kmsconfig.Observer that records OpenTelemetry metrics,
+	// and a span for each load, KMS call and reload.
+	Observer struct {
+		tracer          trace.Tracer
+		loadDuration    metric.Float64Histogram
+		nodesDecrypted  metric.Int64Counter
+		decryptDuration metric.Float64Histogram
+		decrypts        metric.Int64Counter
+		reloads         metric.Int64Counter
+	}
+)
+
+// New creates an Observer that records metrics with meterProvider and spans
+// with tracerProvider.
+func New(meterProvider metric.MeterProvider, tracerProvider trace.TracerProvider) (*Observer, error) {
+	meter := meterProvider.Meter(instrumentationName)
+	observer := &Observer{tracer: tracerProvider.Tracer(instrumentationName)}
+
+	var err error
+	observer.loadDuration, err = meter.Float64Histogram(
+		"kmsconfig.load.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Time taken to load and decrypt an environment."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	observer.nodesDecrypted, err = meter.Int64Counter(
+		"kmsconfig.secure_nodes.decrypted",
+		metric.WithDescription("Secure nodes decrypted by loads, by whether they came from KMS or the decrypt cache."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	observer.decryptDuration, err = meter.Float64Histogram(
+		"kmsconfig.kms.decrypt.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Latency of KMS decrypt calls."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	observer.decrypts, err = meter.Int64Counter(
+		"kmsconfig.decrypts",
+		metric.WithDescription("Secure node decryptions, by result: success, error or cache_hit."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	observer.reloads, err = meter.Int64Counter(
+		"kmsconfig.reloads",
+		metric.WithDescription("Config reloads, by result."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return observer, nil
+}
+
+func (o *Observer) ObserveLoad(ctx context.Context, event kmsconfig.LoadEvent) {
+	env := attribute.String("env", event.Env)
+	o.loadDuration.Record(ctx, event.Duration.Seconds(), metric.WithAttributes(env, result(event.Err)))
+	o.nodesDecrypted.Add(ctx, int64(event.Decrypted-event.CacheHits), metric.WithAttributes(env, attribute.String("source", "kms")))
+	o.nodesDecrypted.Add(ctx, int64(event.CacheHits), metric.WithAttributes(env, attribute.String("source", "cache")))
+
+	o.span(ctx, "kmsconfig.Load", event.Duration, event.Err,
+		env,
+		attribute.Int("kmsconfig.decrypted", event.Decrypted),
+		attribute.Int("kmsconfig.cache_hits", event.CacheHits),
+	)
+}
+
+func (o *Observer) ObserveDecrypt(ctx context.Context, event kmsconfig.DecryptEvent) {
+	if event.CacheHit {
+		o.decrypts.Add(ctx, 1, metric.WithAttributes(attribute.String("result", "cache_hit")))
+		return
+	}
+
+	o.decrypts.Add(ctx, 1, metric.WithAttributes(result(event.Err)))
+	o.decryptDuration.Record(ctx, event.Duration.Seconds(), metric.WithAttributes(result(event.Err)))
+
+	o.span(ctx, "kmsconfig.Decrypt", event.Duration, event.Err,
+		attribute.String("kmsconfig.section", event.Section),
+		attribute.String("kmsconfig.key", event.Key),
+	)
+}
+
+func (o *Observer) ObserveReload(ctx context.Context, event kmsconfig.ReloadEvent) {
+	env := attribute.String("env", event.Env)
+	o.reloads.Add(ctx, 1, metric.WithAttributes(env, result(event.Err)))
+
+	o.span(ctx, "kmsconfig.Reload", event.Duration, event.Err, env)
+}
+
+// span records a span for an operation that has already finished, which
+// started duration ago, as a child of the span in ctx.
+func (o *Observer) span(ctx context.Context, name string, duration time.Duration, err error, attributes ...attribute.KeyValue) {
+	end := time.Now()
+	_, span := o.tracer.Start(
+		ctx,
+		name,
+		trace.WithTimestamp(end.Add(-duration)),
+		trace.WithAttributes(attributes...),
+	)
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End(trace.WithTimestamp(end))
+}
+
+func result(err error) attribute.KeyValue {
+	if err != nil {
+		return attribute.String("result", "error")
+	}
+
+	return attribute.String("result", "success")
+}
@@ -0,0 +1,94 @@
+package otelobserver_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/vidsy/go-kmsconfig/v6/kmsconfig"
+	"github.com/vidsy/go-kmsconfig/v6/kmsconfig/otelobserver"
+)
+
+func TestObserver(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	recorder := tracetest.NewSpanRecorder()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	observer, err := otelobserver.New(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)), tracerProvider)
+	assert.NoError(t, err)
+
+	ctx, parent := tracerProvider.Tracer("test").Start(context.Background(), "parent")
+
+	observer.ObserveLoad(ctx, kmsconfig.LoadEvent{Env: "staging", Duration: time.Second, Decrypted: 3, CacheHits: 1})
+	observer.ObserveDecrypt(ctx, kmsconfig.DecryptEvent{Section: "app", Key: "db_password", Duration: time.Millisecond})
+	observer.ObserveDecrypt(ctx, kmsconfig.DecryptEvent{Section: "app", Key: "api_key", CacheHit: true})
+	observer.ObserveReload(ctx, kmsconfig.ReloadEvent{Env: "staging", Err: errors.New("boom")})
+
+	var metrics metricdata.ResourceMetrics
+	assert.NoError(t, reader.Collect(context.Background(), &metrics))
+
+	sums := make(map[string]map[string]int64)
+	for _, scopeMetrics := range metrics.ScopeMetrics {
+		for _, metric := range scopeMetrics.Metrics {
+			sum, ok := metric.Data.(metricdata.Sum[int64])
+			if !ok {
+				continue
+			}
+
+			sums[metric.Name] = make(map[string]int64)
+			for _, point := range sum.DataPoints {
+				sums[metric.Name][point.Attributes.Encoded(attribute.DefaultEncoder())] = point.Value
+			}
+		}
+	}
+
+	t.Run("CountsSecureNodesBySource", func(t *testing.T) {
+		assert.Equal(t, map[string]int64{
+			"env=staging,source=kms":   2,
+			"env=staging,source=cache": 1,
+		}, sums["kmsconfig.secure_nodes.decrypted"])
+	})
+
+	t.Run("CountsDecryptsByResult", func(t *testing.T) {
+		assert.Equal(t, map[string]int64{
+			"result=success":   1,
+			"result=cache_hit": 1,
+		}, sums["kmsconfig.decrypts"])
+	})
+
+	t.Run("CountsFailedReloads", func(t *testing.T) {
+		assert.Equal(t, map[string]int64{"env=staging,result=error": 1}, sums["kmsconfig.reloads"])
+	})
+
+	t.Run("RecordsSpansForLoadsKMSCallsAndReloads", func(t *testing.T) {
+		spans := recorder.Ended()
+		if !assert.Len(t, spans, 3) {
+			return
+		}
+
+		assert.Equal(t, "kmsconfig.Load", spans[0].Name())
+		assert.Equal(t, time.Second, spans[0].EndTime().Sub(spans[0].StartTime()))
+		assert.Contains(t, spans[0].Attributes(), attribute.Int("kmsconfig.cache_hits", 1))
+
+		assert.Equal(t, "kmsconfig.Decrypt", spans[1].Name())
+		assert.Contains(t, spans[1].Attributes(), attribute.String("kmsconfig.key", "db_password"))
+
+		assert.Equal(t, "kmsconfig.Reload", spans[2].Name())
+		assert.Equal(t, codes.Error, spans[2].Status().Code)
+		assert.Equal(t, "boom", spans[2].Status().Description)
+	})
+
+	t.Run("RecordsSpansAsChildrenOfTheCallersSpan", func(t *testing.T) {
+		for _, span := range recorder.Ended() {
+			assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package kmsconfig
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+)
+
+type (
+	// TLSKeyPair a section holding a PEM encoded certificate chain in its
+	// cert node and the matching private key in its key node. Certificate
+	// is built from them when the config is populated.
+	TLSKeyPair struct {
+		Cert        []byte          `config:"cert"`
+		Key         []byte          `config:"key"`
+		Certificate tls.Certificate `config:"-"`
+	}
+
+	// CertPool a node holding one or more PEM encoded certificates, such as
+	// a CA bundle, populated as an x509.CertPool.
+	CertPool struct {
+		*x509.CertPool
+	}
+
+	// sectionBuilder is implemented by section types that derive fields
+	// from their nodes once they've been populated.
+	sectionBuilder interface {
+		build(section string) error
+	}
+)
+
+var certPoolType = reflect.TypeOf(CertPool{})
+
+func (p *TLSKeyPair) build(section string) error {
+	certificate, err := tls.X509KeyPair(p.Cert, p.Key)
+	if err != nil {
+		return fmt.Errorf("invalid TLS key pair in section %s: %s", section, err)
+	}
+
+	p.Certificate = certificate
+	return nil
+}
+
+// newCertPool builds a CertPool from a node's PEM encoded certificates.
+func newCertPool(nodeData interface{}) (CertPool, error) {
+	value, ok := nodeData.(string)
+	if !ok {
+		return CertPool{}, fmt.Errorf("expected a string of PEM encoded certificates, got: %T", nodeData)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemData(value)) {
+		return CertPool{}, fmt.Errorf("no PEM encoded certificates found")
+	}
+
+	return CertPool{pool}, nil
+}
+
+// byteSlice returns the bytes of a node: the plaintext of a secure node, or
+// the base64 decoded value otherwise. PEM data is used as is, so that
+// certificates don't need to be encoded twice.
+func byteSlice(configNode ConfigNode) ([]byte, error) {
+	value, ok := configNode.Value.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected a string, got: %T", configNode.Value)
+	}
+
+	if configNode.Secure || isPEM([]byte(value)) {
+		return []byte(value), nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("expected a base64 encoded value: %s", err)
+	}
+
+	return decoded, nil
+}
+
+// pemData returns a value as PEM, base64 decoding it first if it isn't
+// already PEM encoded.
+func pemData(value string) []byte {
+	if isPEM([]byte(value)) {
+		return []byte(value)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return []byte(value)
+	}
+
+	return decoded
+}
+
+func isPEM(data []byte) bool {
+	return bytes.Contains(data, []byte("-----BEGIN "))
+}
@@ -0,0 +1,100 @@
+// Package promobserver reports kmsconfig loads, decryptions and reloads as
+// Prometheus metrics.
+package promobserver
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/vidsy/go-kmsconfig/v6/kmsconfig"
+)
+
+const namespace = "kmsconfig"
+
+type (
+	// Observer is a kmsconfig.Observer that records Prometheus metrics.
+	Observer struct {
+		loadDuration    *prometheus.HistogramVec
+		nodesDecrypted  *prometheus.CounterVec
+		decryptDuration *prometheus.HistogramVec
+		decrypts        *prometheus.CounterVec
+		reloads         *prometheus.CounterVec
+	}
+)
+
+// New creates an Observer and registers its metrics with registerer.
+func New(registerer prometheus.Registerer) (*Observer, error) {
+	observer := &Observer{
+		loadDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "load_duration_seconds",
+			Help:      "Time taken to load and decrypt an environment.",
+		}, []string{"env", "result"}),
+		nodesDecrypted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "secure_nodes_decrypted_total",
+			Help:      "Secure nodes decrypted by loads, by whether they came from KMS or the decrypt cache.",
+		}, []string{"env", "source"}),
+		decryptDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "kms_decrypt_duration_seconds",
+			Help:      "Latency of KMS decrypt calls.",
+		}, []string{"result"}),
+		decrypts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "decrypts_total",
+			Help:      "Secure node decryptions, by result: success, error or cache_hit.",
+		}, []string{"result"}),
+		reloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "reloads_total",
+			Help:      "Config reloads, by result.",
+		}, []string{"env", "result"}),
+	}
+
+	collectors := []prometheus.Collector{
+		observer.loadDuration,
+		observer.nodesDecrypted,
+		observer.decryptDuration,
+		observer.decrypts,
+		observer.reloads,
+	}
+
+	for _, collector := range collectors {
+		err := registerer.Register(collector)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return observer, nil
+}
+
+func (o *Observer) ObserveLoad(_ context.Context, event kmsconfig.LoadEvent) {
+	o.loadDuration.WithLabelValues(event.Env, result(event.Err)).Observe(event.Duration.Seconds())
+	o.nodesDecrypted.WithLabelValues(event.Env, "kms").Add(float64(event.Decrypted - event.CacheHits))
+	o.nodesDecrypted.WithLabelValues(event.Env, "cache").Add(float64(event.CacheHits))
+}
+
+func (o *Observer) ObserveDecrypt(_ context.Context, event kmsconfig.DecryptEvent) {
+	if event.CacheHit {
+		o.decrypts.WithLabelValues("cache_hit").Inc()
+		return
+	}
+
+	o.decrypts.WithLabelValues(result(event.Err)).Inc()
+	o.decryptDuration.WithLabelValues(result(event.Err)).Observe(event.Duration.Seconds())
+}
+
+func (o *Observer) ObserveReload(_ context.Context, event kmsconfig.ReloadEvent) {
+	o.reloads.WithLabelValues(event.Env, result(event.Err)).Inc()
+}
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+
+	return "success"
+}
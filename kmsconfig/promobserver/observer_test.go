@@ -0,0 +1,49 @@
+package promobserver_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vidsy/go-kmsconfig/v6/kmsconfig"
+	"github.com/vidsy/go-kmsconfig/v6/kmsconfig/promobserver"
+)
+
+func TestObserver(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	observer, err := promobserver.New(registry)
+	assert.NoError(t, err)
+
+	observer.ObserveLoad(context.Background(), kmsconfig.LoadEvent{Env: "staging", Duration: time.Second, Decrypted: 3, CacheHits: 1})
+	observer.ObserveDecrypt(context.Background(), kmsconfig.DecryptEvent{Section: "app", Key: "db_password", Duration: time.Millisecond})
+	observer.ObserveDecrypt(context.Background(), kmsconfig.DecryptEvent{Section: "app", Key: "api_key", CacheHit: true})
+	observer.ObserveReload(context.Background(), kmsconfig.ReloadEvent{Env: "staging", Err: errors.New("boom")})
+
+	t.Run("CountsSecureNodesBySource", func(t *testing.T) {
+		count, err := testutil.GatherAndCount(registry, "kmsconfig_secure_nodes_decrypted_total")
+		assert.NoError(t, err)
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("CountsDecryptsByResult", func(t *testing.T) {
+		count, err := testutil.GatherAndCount(registry, "kmsconfig_decrypts_total")
+		assert.NoError(t, err)
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("CountsFailedReloads", func(t *testing.T) {
+		count, err := testutil.GatherAndCount(registry, "kmsconfig_reloads_total")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("ReturnsErrorWhenAlreadyRegistered", func(t *testing.T) {
+		_, err := promobserver.New(registry)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,153 @@
+package kmsconfig
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	providerFieldName = "provider"
+	vaultProvider     = "vault"
+)
+
+// routeSecureValue picks the decrypter for a secure value, from the node's
+// provider field or a "provider:" prefix on the ciphertext, returning it
+// with the ciphertext it expects and its name. Vault and envelope values
+// keep their prefix, as it's part of their ciphertext. Values with neither
+// go to the default decrypter, which is KMS unless Decrypter or KeyFiles
+// say otherwise.
+func (c Config) routeSecureValue(provider string, value string) (Decrypter, string, string, error) {
+	if provider == "" {
+		if prefix, ciphertext, ok := strings.Cut(value, ":"); ok && isProviderName(prefix) {
+			provider = prefix
+			if provider != vaultProvider && provider != envelopeProvider {
+				value = ciphertext
+			}
+		}
+	}
+
+	if provider == "" {
+		decrypter := c.decrypter()
+		return decrypter, value, decrypterLocation(decrypter), nil
+	}
+
+	decrypter, ok := c.registeredDecrypter(provider)
+	if !ok {
+		return nil, "", "", fmt.Errorf("no decrypter registered for provider '%s'", provider)
+	}
+
+	return decrypter, value, provider, nil
+}
+
+// routeNode routes the secure value of a node, giving the KMSWrapper the
+// node's encryption context when it's routed to KMS.
+func (c Config) routeNode(section string, key string, nodeValue map[string]interface{}, value string) (Decrypter, string, string, error) {
+	provider, _ := nodeValue[providerFieldName].(string)
+	decrypter, ciphertext, name, err := c.routeSecureValue(provider, value)
+	if kmsWrapper, isKMS := decrypter.(KMSWrapper); isKMS {
+		decrypter = c.nodeKMSWrapper(kmsWrapper, section, key, nodeValue)
+	}
+
+	return decrypter, ciphertext, name, err
+}
+
+// registeredDecrypter returns the decrypter for a provider from Decrypters,
+// falling back to the KMSWrapper for "kms" and "envelope", the VaultClient
+// for "vault" and the default decrypter when it has the provider's name,
+// such as an "age" key file.
+func (c Config) registeredDecrypter(provider string) (Decrypter, bool) {
+	if decrypter, ok := c.Decrypters[provider]; ok {
+		return decrypter, true
+	}
+
+	switch {
+	case provider == kmsLocation || provider == envelopeProvider:
+		return c.KMSWrapper, true
+	case provider == vaultProvider && c.VaultClient != nil:
+		return c.VaultClient, true
+	}
+
+	// A key file that failed to load may have been the provider, so its
+	// error is more useful than an unregistered provider.
+	decrypter := c.decrypter()
+	if _, failed := decrypter.(failingDecrypter); failed || decrypterLocation(decrypter) == provider {
+		return decrypter, true
+	}
+
+	return nil, false
+}
+
+// nodeEncrypter returns the encrypter for a secure node and the prefix to
+// store in front of its ciphertext, routed the same way the node is
+// decrypted: by its provider field, then the provider prefix on
+// storedValue, its current ciphertext if it has one, then the default
+// encrypter. A prefix on storedValue is kept, including "kms:", so the new
+// ciphertext doesn't fall through to a different default decrypter. The
+// KMSWrapper is given the node's encryption context, and envelope encrypts
+// when storedValue was envelope encrypted.
+func (c Config) nodeEncrypter(section string, key string, nodeValue map[string]interface{}, storedValue string) (Encrypter, string, error) {
+	provider, hasField := nodeValue[providerFieldName].(string)
+	if provider == "" {
+		if prefix, _, ok := strings.Cut(storedValue, ":"); ok && isProviderName(prefix) {
+			provider = prefix
+		}
+	}
+
+	var encrypter Encrypter
+	prefix := ""
+	if provider == "" {
+		encrypter = c.encrypter()
+		prefix = providerPrefix(encrypter)
+	} else {
+		decrypter, ok := c.registeredDecrypter(provider)
+		if !ok {
+			return nil, "", fmt.Errorf("no decrypter registered for provider '%s'", provider)
+		}
+
+		encrypter, ok = decrypter.(Encrypter)
+		if !ok {
+			return nil, "", fmt.Errorf("decrypter for provider '%s' can't encrypt", provider)
+		}
+
+		if !hasField && provider != vaultProvider && provider != envelopeProvider {
+			prefix = provider + ":"
+		}
+	}
+
+	if kmsWrapper, isKMS := encrypter.(KMSWrapper); isKMS {
+		kmsWrapper = c.nodeKMSWrapper(kmsWrapper, section, key, nodeValue)
+		kmsWrapper.Envelope = kmsWrapper.Envelope || provider == envelopeProvider
+		encrypter = kmsWrapper
+	}
+
+	return encrypter, prefix, nil
+}
+
+// providerPrefix returns the prefix to store in front of ciphertext from an
+// encrypter so it's routed back to it. KMS ciphertext is left unprefixed so
+// older versions can still read it, and Vault's ciphertext carries its own.
+func providerPrefix(encrypter Encrypter) string {
+	location := decrypterLocation(encrypter)
+	if location == kmsLocation || location == vaultProvider || !isProviderName(location) {
+		return ""
+	}
+
+	return location + ":"
+}
+
+// isProviderName reports whether a ciphertext prefix names a provider.
+// Base64 never contains a colon, so only lowercase names are accepted to
+// keep the check strict.
+func isProviderName(prefix string) bool {
+	if prefix == "" {
+		return false
+	}
+
+	for _, r := range prefix {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return false
+		}
+	}
+
+	return true
+}
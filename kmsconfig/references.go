@@ -0,0 +1,73 @@
+package kmsconfig
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+type (
+	// references holds the values fetched for one load for nodes that refer
+	// to values stored outside the config file, so each is fetched once.
+	references struct {
+		parameters   map[string]types.Parameter
+		secrets      map[secretVersion]fetchedSecret
+		vaultSecrets map[string]fetchedVaultSecret
+	}
+)
+
+// isReference reports whether a stored node refers to a value held outside
+// the config file, rather than holding the value or its ciphertext.
+func isReference(nodeValue map[string]interface{}) bool {
+	if _, ok := ssmReference(nodeValue, nodeValue[valueFieldName], false); ok {
+		return true
+	}
+
+	if _, ok := parseSecretReference(nodeValue[valueFieldName]); ok {
+		return true
+	}
+
+	_, ok := parseVaultReference(nodeValue[valueFieldName])
+	return ok
+}
+
+// fetchReferences fetches the parameters and secrets the nodes refer to,
+// taking overrides into account.
+func (c Config) fetchReferences(ctx context.Context, data map[string]map[string]map[string]interface{}) (references, error) {
+	parameterNames := make(map[string]bool)
+	secrets := make(map[secretVersion]fetchedSecret)
+	vaultSecrets := make(map[string]fetchedVaultSecret)
+
+	for sectionKey, sectionValue := range data {
+		for nodeKey, nodeValue := range sectionValue {
+			value := nodeValue[valueFieldName]
+			override := os.Getenv(fmt.Sprintf(overrideEnvStructure, sectionKey, nodeKey))
+			if override != "" {
+				value = override
+			}
+
+			if name, ok := ssmReference(nodeValue, value, override != ""); ok {
+				parameterNames[name] = true
+			}
+
+			if reference, ok := parseSecretReference(value); ok {
+				secrets[reference.secretVersion] = fetchedSecret{}
+			}
+
+			if reference, ok := parseVaultReference(value); ok {
+				vaultSecrets[reference.mount+"/"+reference.path] = fetchedVaultSecret{}
+			}
+		}
+	}
+
+	parameters, err := c.fetchSSMParameters(ctx, unionKeys(parameterNames, nil))
+	if err != nil {
+		return references{}, err
+	}
+
+	c.fetchSecrets(ctx, secrets)
+	c.fetchVaultSecrets(vaultSecrets)
+	return references{parameters, secrets, vaultSecrets}, nil
+}
@@ -0,0 +1,284 @@
+package kmsconfig
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+)
+
+const defaultWatchInterval = 10 * time.Second
+
+type (
+	// ChangeEvent describes a node that changed during a reload. Old is nil
+	// for added nodes and New is nil for removed nodes.
+	ChangeEvent struct {
+		Section string
+		Key     string
+		Old     *ConfigNode
+		New     *ConfigNode
+	}
+
+	changeSubscription struct {
+		section string
+		key     string
+		handler func(ChangeEvent)
+	}
+
+	populateSubscription struct {
+		configType reflect.Type
+		handler    func(interface{})
+	}
+)
+
+// Subscribe calls handler with a ChangeEvent for each node that a reload
+// adds, removes or changes. An empty section or key matches any value.
+func (c *Config) Subscribe(section string, key string, handler func(ChangeEvent)) {
+	state := c.state()
+	state.subscriptionMutex.Lock()
+	defer state.subscriptionMutex.Unlock()
+
+	state.changeSubscriptions = append(state.changeSubscriptions, changeSubscription{section, key, handler})
+}
+
+// SubscribePopulated calls handler after each successful reload with a
+// newly allocated struct of the same type as config, populated from the
+// reloaded sections. A reload that can't populate the struct is rejected.
+func (c *Config) SubscribePopulated(config interface{}, handler func(interface{})) error {
+	configType := reflect.TypeOf(config)
+	if configType == nil || configType.Kind() != reflect.Ptr || configType.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("Struct must be passed by reference")
+	}
+
+	state := c.state()
+	state.subscriptionMutex.Lock()
+	defer state.subscriptionMutex.Unlock()
+
+	state.populateSubscriptions = append(state.populateSubscriptions, populateSubscription{configType.Elem(), handler})
+	return nil
+}
+
+// OnReloadError calls handler with the error from each failed reload.
+func (c *Config) OnReloadError(handler func(error)) {
+	state := c.state()
+	state.subscriptionMutex.Lock()
+	defer state.subscriptionMutex.Unlock()
+
+	state.errorHandlers = append(state.errorHandlers, handler)
+}
+
+// Reload re-reads and decrypts the environment file, or the environment
+// variables if LoadAndPopulate loaded the config from them alone, and swaps
+// the new sections in. If the config can't be loaded, breaks the
+// UnknownNodes policy, or a struct registered with SubscribePopulated can't
+// be populated from it, the last good config is kept and the error is
+// reported to the OnReloadError handlers.
+func (c *Config) Reload() error {
+	return c.ReloadContext(context.Background())
+}
+
+// ReloadContext reloads the config like Reload, passing ctx on as
+// LoadContext does.
+func (c *Config) ReloadContext(ctx context.Context) error {
+	state := c.state()
+
+	start := time.Now()
+	err := c.reload(ctx, state)
+	c.observer().ObserveReload(ctx, ReloadEvent{c.Env, time.Since(start), err})
+	if err != nil {
+		c.logger().Error("Config reload failed, keeping the last good config", "error", err)
+
+		state.subscriptionMutex.RLock()
+		errorHandlers := state.errorHandlers
+		state.subscriptionMutex.RUnlock()
+
+		for _, handler := range errorHandlers {
+			handler(err)
+		}
+	}
+
+	return err
+}
+
+func (c *Config) reload(ctx context.Context, state *configState) error {
+	state.subscriptionMutex.RLock()
+	populatedType := state.populatedType
+	fromEnvironment := state.fromEnvironment
+	populateSubscriptions := state.populateSubscriptions
+	changeSubscriptions := state.changeSubscriptions
+	state.subscriptionMutex.RUnlock()
+
+	snapshot, err := c.reloadSnapshot(ctx, populatedType, fromEnvironment)
+	if err != nil {
+		return err
+	}
+
+	// Populating happens against a candidate with its own state until the
+	// reload is known to be good.
+	candidate := c.withSnapshot(snapshot)
+
+	populated := make([]interface{}, len(populateSubscriptions))
+	for i, subscription := range populateSubscriptions {
+		populated[i], err = candidate.repopulate(ctx, subscription.configType, fromEnvironment)
+		if err != nil {
+			return err
+		}
+	}
+
+	var previous map[string]ConfigSection
+	state.update(func(current *Snapshot) error {
+		previous = current.sections
+		*current = *snapshot
+		return nil
+	})
+
+	for _, event := range changeEvents(previous, snapshot.sections) {
+		for _, subscription := range changeSubscriptions {
+			if subscription.matches(event) {
+				subscription.handler(event)
+			}
+		}
+	}
+
+	for i, subscription := range populateSubscriptions {
+		subscription.handler(populated[i])
+	}
+
+	return nil
+}
+
+// reloadSnapshot loads the config the way LoadAndPopulate last did, from
+// environment variables alone or from the environment file, and applies
+// the UnknownNodes policy to the struct it populated.
+func (c *Config) reloadSnapshot(ctx context.Context, populatedType reflect.Type, fromEnvironment bool) (*Snapshot, error) {
+	if fromEnvironment {
+		snapshot, unmatchedEnvVars, err := c.loadEnvironment(ctx, reflect.New(populatedType).Interface())
+		if err != nil {
+			return nil, err
+		}
+
+		return snapshot, c.reportUnmappedNodes("environment variable", unmatchedEnvVars)
+	}
+
+	snapshot, err := c.load(ctx)
+	if err != nil || populatedType == nil {
+		return snapshot, err
+	}
+
+	candidate := c.withSnapshot(snapshot)
+	return snapshot, candidate.reportUnmappedNodes("config node", candidate.unmappedNodes(populatedType))
+}
+
+// repopulate populates a new struct of configType for a populate
+// subscription, from environment variables alone if the config was loaded
+// that way and otherwise from the reloaded sections, applying the
+// UnknownNodes policy as Populate does.
+func (c Config) repopulate(ctx context.Context, configType reflect.Type, fromEnvironment bool) (interface{}, error) {
+	config := reflect.New(configType).Interface()
+	if !fromEnvironment {
+		return config, c.Populate(config)
+	}
+
+	unmatchedEnvVars, err := loadEnvConfig(ctx, config, c.decryptSecureValue, make(map[string]ConfigSection))
+	if err != nil {
+		return nil, err
+	}
+
+	return config, c.reportUnmappedNodes("environment variable", unmatchedEnvVars)
+}
+
+// Watch polls the environment file, .env file and the environment's key
+// file every WatchInterval, defaulting to 10 seconds, and reloads with ctx
+// when any of them changes. It blocks until ctx is done.
+func (c *Config) Watch(ctx context.Context) error {
+	interval := c.WatchInterval
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	fingerprint := c.fingerprint()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			latest := c.fingerprint()
+			if latest == fingerprint {
+				continue
+			}
+
+			fingerprint = latest
+			c.ReloadContext(ctx)
+		}
+	}
+}
+
+// fingerprint hashes the files a load reads, including the environment's
+// key file, so that a change to any of them, including one being created or
+// removed, can be detected.
+func (c Config) fingerprint() [sha256.Size]byte {
+	paths := []string{c.generatePath(), dotenvPath}
+	if keyFile, ok := c.keyFilePath(); ok {
+		paths = append(paths, keyFile)
+	}
+
+	hash := sha256.New()
+	for _, path := range paths {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(hash, "%s: %s\n", path, err)
+			continue
+		}
+
+		fmt.Fprintf(hash, "%s: %d\n", path, len(contents))
+		hash.Write(contents)
+	}
+
+	var sum [sha256.Size]byte
+	copy(sum[:], hash.Sum(nil))
+	return sum
+}
+
+func (s changeSubscription) matches(event ChangeEvent) bool {
+	return (s.section == "" || s.section == event.Section) && (s.key == "" || s.key == event.Key)
+}
+
+func changeEvents(previous map[string]ConfigSection, current map[string]ConfigSection) []ChangeEvent {
+	var events []ChangeEvent
+
+	for _, sectionKey := range unionKeys(previous, current) {
+		previousNodes := previous[sectionKey].Nodes
+		currentNodes := current[sectionKey].Nodes
+
+		for _, nodeKey := range unionKeys(previousNodes, currentNodes) {
+			previousNode, hadNode := previousNodes[nodeKey]
+			currentNode, hasNode := currentNodes[nodeKey]
+			if hadNode && hasNode && nodesEqual(previousNode, currentNode) {
+				continue
+			}
+
+			event := ChangeEvent{Section: sectionKey, Key: nodeKey}
+			if hadNode {
+				event.Old = &previousNode
+			}
+			if hasNode {
+				event.New = &currentNode
+			}
+
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
+
+func nodesEqual(a ConfigNode, b ConfigNode) bool {
+	return a.Secure == b.Secure &&
+		a.EncryptedValue == b.EncryptedValue &&
+		reflect.DeepEqual(a.Value, b.Value)
+}
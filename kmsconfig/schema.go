@@ -0,0 +1,244 @@
+package kmsconfig
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+type (
+	jsonSchema map[string]interface{}
+)
+
+// Schema generates a JSON Schema for environment files from the struct
+// config points to. Node types come from the field types and the
+// config_duration_type tag, and the config_default, config_secure,
+// config_enum, config_min and config_max tags become the matching schema
+// keywords. Nodes tagged config_secure:"true" must be secure, and nodes
+// without a default are required.
+func Schema(config interface{}) ([]byte, error) {
+	configType := reflect.TypeOf(config)
+	if configType == nil || configType.Kind() != reflect.Ptr || configType.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("Struct must be passed by reference")
+	}
+	configType = configType.Elem()
+
+	sections := jsonSchema{}
+	var requiredSections []string
+
+	for i := 0; i < configType.NumField(); i++ {
+		nodeFieldType := configType.Field(i)
+		nodeTag := nodeFieldType.Tag.Get(configNodeName)
+		if nodeTag == configOmitField || nodeFieldType.Type.Kind() == reflect.Map {
+			continue
+		}
+
+		if nodeFieldType.Type.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("config field %s is not a struct", nodeFieldType.Name)
+		}
+
+		nodes := jsonSchema{}
+		var requiredNodes []string
+
+		for j := 0; j < nodeFieldType.Type.NumField(); j++ {
+			sectionFieldType := nodeFieldType.Type.Field(j)
+			sectionTag := sectionFieldType.Tag.Get(configNodeName)
+			if sectionTag == configOmitField {
+				continue
+			}
+
+			nodeSchema, err := fieldSchema(sectionFieldType)
+			if err != nil {
+				return nil, fmt.Errorf("config field %s.%s: %s", nodeFieldType.Name, sectionFieldType.Name, err)
+			}
+
+			nodes[sectionTag] = nodeSchema
+			if _, hasDefault := sectionFieldType.Tag.Lookup(configDefaultNodeName); !hasDefault {
+				requiredNodes = append(requiredNodes, sectionTag)
+			}
+		}
+
+		sections[nodeTag] = objectSchema(nodes, requiredNodes)
+		if len(requiredNodes) > 0 {
+			requiredSections = append(requiredSections, nodeTag)
+		}
+	}
+
+	schema := objectSchema(sections, requiredSections)
+	schema["$schema"] = jsonSchemaDialect
+
+	return encodeJSON(schema)
+}
+
+// FileSchema returns a JSON Schema for the environment file format itself,
+// for use where the struct a service populates isn't available.
+func FileSchema() []byte {
+	schema := jsonSchema{
+		"$schema": jsonSchemaDialect,
+		"type":    "object",
+		"additionalProperties": jsonSchema{
+			"type": "object",
+			"additionalProperties": jsonSchema{
+				"type": "object",
+				"properties": jsonSchema{
+					valueFieldName:    jsonSchema{},
+					secureFieldName:   jsonSchema{"type": "boolean"},
+					ssmFieldName:      jsonSchema{"type": "string"},
+					providerFieldName: jsonSchema{"type": "string"},
+					encryptionContextFieldName: jsonSchema{
+						"type":                 "object",
+						"additionalProperties": jsonSchema{"type": "string"},
+					},
+				},
+				"anyOf": []jsonSchema{
+					{"required": []string{valueFieldName}},
+					{"required": []string{ssmFieldName}},
+				},
+			},
+		},
+	}
+
+	contents, _ := encodeJSON(schema)
+	return contents
+}
+
+// fieldSchema returns the schema for the node a field is populated from,
+// which holds either a value or, as FileSchema allows, an SSM parameter
+// name in place of it.
+func fieldSchema(field reflect.StructField) (jsonSchema, error) {
+	secure := field.Tag.Get(configSecureNodeName) == "true"
+
+	valueSchema, err := valueSchema(field)
+	if err != nil {
+		return nil, err
+	}
+
+	secureSchema := jsonSchema{"type": "boolean"}
+	required := []string{valueFieldName}
+
+	if secure {
+		valueSchema = jsonSchema{
+			"type":        "string",
+			"description": "KMS encrypted, base64 encoded value",
+		}
+		secureSchema = jsonSchema{"const": true}
+		required = append(required, secureFieldName)
+	}
+
+	schema := objectSchema(
+		jsonSchema{
+			valueFieldName:  valueSchema,
+			secureFieldName: secureSchema,
+			ssmFieldName:    jsonSchema{"type": "string"},
+		},
+		nil,
+	)
+	sort.Strings(required)
+	schema["anyOf"] = []jsonSchema{
+		{"required": required},
+		{"required": []string{ssmFieldName}},
+	}
+
+	return schema, nil
+}
+
+func valueSchema(field reflect.StructField) (jsonSchema, error) {
+	schema := jsonSchema{}
+
+	switch field.Type.Kind() {
+	case reflect.String:
+		schema["type"] = "string"
+	case reflect.Struct:
+		if field.Type != certPoolType {
+			return nil, fmt.Errorf("fields of kind %s aren't supported", field.Type.Kind())
+		}
+
+		schema["type"] = "string"
+		schema["description"] = "PEM encoded certificates"
+	case reflect.Slice:
+		if field.Type.Elem().Kind() == reflect.Interface {
+			schema["type"] = "array"
+			break
+		}
+
+		if field.Type.Elem().Kind() != reflect.Uint8 {
+			schema["type"] = "array"
+			schema["items"] = jsonSchema{"type": "string"}
+			break
+		}
+
+		schema["type"] = "string"
+		schema["description"] = "base64 or PEM encoded bytes"
+	case reflect.Bool:
+		schema["type"] = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		schema["type"] = "integer"
+		if field.Type == reflect.TypeOf(time.Duration(0)) {
+			schema["description"] = "duration in " + field.Tag.Get(configDurationTypeNodeName)
+		}
+	case reflect.Float32, reflect.Float64:
+		schema["type"] = "number"
+	case reflect.Map:
+		schema["type"] = "object"
+	default:
+		return nil, fmt.Errorf("fields of kind %s aren't supported", field.Type.Kind())
+	}
+
+	if defaultValue, ok := field.Tag.Lookup(configDefaultNodeName); ok {
+		value, err := defaultNodeData(field.Type, defaultValue)
+		if err != nil {
+			return nil, err
+		}
+
+		schema["default"] = value
+	}
+
+	if enum, ok := field.Tag.Lookup(configEnumNodeName); ok {
+		var values []interface{}
+		for _, value := range strings.Split(enum, ",") {
+			enumValue, err := defaultNodeData(field.Type, value)
+			if err != nil {
+				return nil, err
+			}
+
+			values = append(values, enumValue)
+		}
+
+		schema["enum"] = values
+	}
+
+	for tag, keyword := range map[string]string{configMinNodeName: "minimum", configMaxNodeName: "maximum"} {
+		limitTag, ok := field.Tag.Lookup(tag)
+		if !ok {
+			continue
+		}
+
+		limit, err := strconv.ParseFloat(limitTag, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid '%s' tag: %s", tag, err)
+		}
+
+		schema[keyword] = limit
+	}
+
+	return schema, nil
+}
+
+func objectSchema(properties jsonSchema, required []string) jsonSchema {
+	schema := jsonSchema{
+		"type":       "object",
+		"properties": properties,
+	}
+
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+
+	return schema
+}
@@ -0,0 +1,34 @@
+package kmsconfig
+
+import (
+	"encoding/json"
+)
+
+const redactedValue = "[redacted]"
+
+type (
+	// Secret a string populated from a secure node. It is redacted when
+	// printed or marshalled to JSON, so it doesn't end up in logs by
+	// accident; use Value to read the plaintext.
+	Secret string
+)
+
+// Value returns the plaintext of the secret.
+func (s Secret) Value() string {
+	return string(s)
+}
+
+// String implements fmt.Stringer, returning a redacted placeholder.
+func (s Secret) String() string {
+	return redactedValue
+}
+
+// GoString implements fmt.GoStringer, returning a redacted placeholder.
+func (s Secret) GoString() string {
+	return redactedValue
+}
+
+// MarshalJSON implements json.Marshaler, returning a redacted placeholder.
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(redactedValue)
+}
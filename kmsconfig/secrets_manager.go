@@ -0,0 +1,161 @@
+package kmsconfig
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+const secretsManagerReferencePrefix = "secretsmanager://"
+
+type (
+	// SecretsManagerAPI the Secrets Manager operations used to resolve
+	// references. *secretsmanager.Client from aws-sdk-go-v2 implements it.
+	SecretsManagerAPI interface {
+		GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+	}
+
+	// secretVersion identifies the version of a secret to fetch.
+	secretVersion struct {
+		name         string
+		versionStage string
+		versionID    string
+	}
+
+	// secretReference is a node value of the form
+	// secretsmanager://name?version_stage=STAGE#json.key, referring to a
+	// secret or to a key within a JSON secret.
+	secretReference struct {
+		secretVersion
+		jsonKey  string
+		location string
+	}
+
+	fetchedSecret struct {
+		value string
+		err   error
+	}
+)
+
+// defaultSecretsManagerClient creates a client for the default AWS config
+// once, the first time Secrets Manager is used without a
+// SecretsManagerClient.
+var defaultSecretsManagerClient = sync.OnceValues(func() (SecretsManagerAPI, error) {
+	awsConfig, err := defaultAWSConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error loading default AWS config for Secrets Manager: %w", err)
+	}
+
+	return secretsmanager.NewFromConfig(awsConfig), nil
+})
+
+func parseSecretReference(value interface{}) (secretReference, bool) {
+	stringValue, ok := value.(string)
+	if !ok || !strings.HasPrefix(stringValue, secretsManagerReferencePrefix) {
+		return secretReference{}, false
+	}
+
+	location := strings.TrimPrefix(stringValue, secretsManagerReferencePrefix)
+	secret, jsonKey, _ := strings.Cut(location, "#")
+	name, rawQuery, _ := strings.Cut(secret, "?")
+	query, _ := url.ParseQuery(rawQuery)
+
+	return secretReference{
+		secretVersion{name, query.Get("version_stage"), query.Get("version_id")},
+		jsonKey,
+		location,
+	}, true
+}
+
+// fetchSecrets fetches each secret version once, recording the value or
+// error for each.
+func (c Config) fetchSecrets(ctx context.Context, secrets map[secretVersion]fetchedSecret) {
+	if len(secrets) == 0 {
+		return
+	}
+
+	client, err := c.secretsManagerClient()
+	if err != nil {
+		for version := range secrets {
+			secrets[version] = fetchedSecret{err: err}
+		}
+
+		return
+	}
+
+	start := time.Now()
+
+	for version := range secrets {
+		input := &secretsmanager.GetSecretValueInput{SecretId: aws.String(version.name)}
+		if version.versionStage != "" {
+			input.VersionStage = aws.String(version.versionStage)
+		}
+		if version.versionID != "" {
+			input.VersionId = aws.String(version.versionID)
+		}
+
+		output, err := client.GetSecretValue(ctx, input)
+		if err != nil {
+			secrets[version] = fetchedSecret{err: err}
+			continue
+		}
+
+		value := aws.ToString(output.SecretString)
+		if output.SecretString == nil {
+			value = string(output.SecretBinary)
+		}
+
+		secrets[version] = fetchedSecret{value: value}
+	}
+
+	c.logger().Debug("Fetched secrets", "count", len(secrets), "duration", time.Since(start))
+}
+
+// resolveSecretReference sets the value of a node that refers to a secret,
+// extracting the JSON key if there is one. The node is always secure.
+func resolveSecretReference(node *ConfigNode, reference secretReference, secrets map[secretVersion]fetchedSecret) error {
+	fetched := secrets[reference.secretVersion]
+	if fetched.err != nil {
+		return fmt.Errorf("error fetching secret '%s': %s", reference.name, fetched.err.Error())
+	}
+
+	var value interface{} = fetched.value
+	if reference.jsonKey != "" {
+		err := json.Unmarshal([]byte(fetched.value), &value)
+		if err != nil {
+			return fmt.Errorf("secret '%s' isn't JSON: %s", reference.name, err.Error())
+		}
+
+		for _, key := range strings.Split(reference.jsonKey, ".") {
+			object, isObject := value.(map[string]interface{})
+			value, isObject = object[key]
+			if !isObject {
+				return fmt.Errorf("key '%s' not found in secret '%s'", reference.jsonKey, reference.name)
+			}
+		}
+	}
+
+	node.Secure = true
+	node.EncryptedValue = secretsManagerReferencePrefix + reference.location
+	node.Value = value
+	node.Sources = append(node.Sources, Source{SourceSecretsManager, reference.location})
+
+	return nil
+}
+
+// secretsManagerClient returns the SecretsManagerClient, or a client for the
+// default AWS config if it isn't set.
+func (c Config) secretsManagerClient() (SecretsManagerAPI, error) {
+	if c.SecretsManagerClient == nil {
+		return defaultSecretsManagerClient()
+	}
+
+	return c.SecretsManagerClient, nil
+}
@@ -0,0 +1,56 @@
+package kmsconfig
+
+import (
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+)
+
+// ReloadOnSignal installs a handler that calls Reload each time the process
+// receives one of signals, or SIGHUP if none are given. The handler is
+// installed before it returns, and is removed by calling stop.
+func (c *Config) ReloadOnSignal(signals ...os.Signal) (stop func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGHUP}
+	}
+
+	received := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(received, signals...)
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case receivedSignal := <-received:
+				c.logger().Info("Received signal, reloading config", "signal", receivedSignal)
+				if c.Reload() == nil {
+					c.logger().Info("Config reloaded", "signal", receivedSignal)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(received)
+			close(done)
+		})
+	}
+}
+
+// PopulateOnReload repopulates the struct config points to after each
+// successful reload, holding locker while it is overwritten. Readers should
+// hold the same lock, or the read half of a sync.RWMutex.
+func (c *Config) PopulateOnReload(config interface{}, locker sync.Locker) error {
+	return c.SubscribePopulated(config, func(populated interface{}) {
+		locker.Lock()
+		defer locker.Unlock()
+
+		reflect.ValueOf(config).Elem().Set(reflect.ValueOf(populated).Elem())
+	})
+}
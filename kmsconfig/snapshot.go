@@ -0,0 +1,285 @@
+package kmsconfig
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+type (
+	// Snapshot an immutable view of a loaded config. Reloads and edits swap
+	// in a new Snapshot rather than changing an existing one, so a Snapshot
+	// is safe to read from any number of goroutines.
+	Snapshot struct {
+		env      string
+		data     map[string]map[string]map[string]interface{}
+		contents []byte
+		sections map[string]ConfigSection
+		loadedAt time.Time
+	}
+
+	// configState is shared by copies of a Config, so that every copy reads
+	// the snapshot most recently swapped in.
+	configState struct {
+		snapshot              atomic.Pointer[Snapshot]
+		writeMutex            sync.Mutex
+		subscriptionMutex     sync.RWMutex
+		changeSubscriptions   []changeSubscription
+		populateSubscriptions []populateSubscription
+		errorHandlers         []func(error)
+		populatedType         reflect.Type
+		fromEnvironment       bool
+		cacheMutex            sync.Mutex
+		decryptCache          map[string]cachedPlaintext
+		keyFileMutex          sync.Mutex
+		keyFiles              map[string]Decrypter
+		defaultsMutex         sync.Mutex
+		defaults              map[string]map[string]ConfigNode
+		dotenvMutex           sync.Mutex
+		dotenvVariables       map[string]bool
+	}
+)
+
+// Snapshot returns the config as it was last loaded, reloaded or edited.
+func (c Config) Snapshot() *Snapshot {
+	if c.shared == nil {
+		return &Snapshot{}
+	}
+
+	return c.shared.current()
+}
+
+// Sections returns the sections of the current snapshot.
+//
+// Deprecated: Sections replaces the v5 Sections field, which could be read
+// while a reload was changing it. Use Snapshot().Sections() instead. It
+// will be removed in v7.
+func (c Config) Sections() map[string]ConfigSection {
+	return c.Snapshot().Sections()
+}
+
+func (s *Snapshot) Boolean(node string, key string) (bool, error) {
+	configNode, err := s.retrieve(node, key, false)
+	if err != nil {
+		return false, err
+	}
+
+	return configNode.(bool), nil
+}
+
+func (s *Snapshot) Environment() string {
+	return s.env
+}
+
+// LoadedAt returns when the snapshot was loaded or reloaded, or the zero
+// time if it has only been read or edited.
+func (s *Snapshot) LoadedAt() time.Time {
+	return s.loadedAt
+}
+
+func (s *Snapshot) Integer(node string, key string) (int, error) {
+	configNode, err := s.retrieve(node, key, false)
+	if err != nil {
+		return 0, err
+	}
+
+	value := configNode.(float64)
+	return int(value), nil
+}
+
+func (s *Snapshot) String(node string, key string) (string, error) {
+	configNode, err := s.retrieve(node, key, false)
+	if err != nil {
+		return "", err
+	}
+
+	return configNode.(string), nil
+}
+
+func (s *Snapshot) StringSlice(node string, key string) ([]string, error) {
+	configNode, err := s.retrieve(node, key, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return stringSlice(configNode)
+}
+
+func (s *Snapshot) EncryptedString(node string, key string) (string, error) {
+	configNode, err := s.retrieve(node, key, true)
+	if err != nil {
+		return "", err
+	}
+
+	return configNode.(string), nil
+}
+
+func (s *Snapshot) RawValue(node string, key string) (interface{}, error) {
+	return s.retrieve(node, key, false)
+}
+
+// Sections returns a copy of the loaded sections.
+func (s *Snapshot) Sections() map[string]ConfigSection {
+	sections := make(map[string]ConfigSection, len(s.sections))
+	for sectionKey, section := range s.sections {
+		nodes := make(map[string]ConfigNode, len(section.Nodes))
+		for nodeKey, node := range section.Nodes {
+			node.Sources = slices.Clone(node.Sources)
+			nodes[nodeKey] = node
+		}
+
+		sections[sectionKey] = ConfigSection{section.Name, nodes}
+	}
+
+	return sections
+}
+
+func (s *Snapshot) retrieve(node string, key string, encryptedValue bool) (interface{}, error) {
+	configNode, err := s.retrieveNode(node, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if encryptedValue {
+		return configNode.EncryptedValue, nil
+	}
+	return configNode.Value, nil
+}
+
+func (s *Snapshot) retrieveNode(node string, key string) (ConfigNode, error) {
+	section, sectionExists := s.sections[node]
+
+	if sectionExists {
+		node, nodeExists := section.Nodes[key]
+
+		if nodeExists {
+			return node, nil
+		}
+
+		return ConfigNode{}, fmt.Errorf("'%s' key doesn't exists on node '%s'", key, section.Name)
+	}
+
+	return ConfigNode{}, fmt.Errorf("The config node '%s' doesn't exist", node)
+}
+
+// withSnapshot returns a copy of the config with its own state holding
+// snapshot, so that it can be populated, recording defaults as it goes,
+// without changing the config it was copied from.
+func (c Config) withSnapshot(snapshot *Snapshot) Config {
+	c.shared = &configState{}
+	c.shared.snapshot.Store(snapshot)
+	return c
+}
+
+// state returns the state shared by copies of the config, creating it the
+// first time a Config not made by NewConfig is used. It's created with a
+// compare and swap so that concurrent first uses all get the same state.
+func (c *Config) state() *configState {
+	shared := (*unsafe.Pointer)(unsafe.Pointer(&c.shared))
+	if state := atomic.LoadPointer(shared); state != nil {
+		return (*configState)(state)
+	}
+
+	atomic.CompareAndSwapPointer(shared, nil, unsafe.Pointer(&configState{}))
+	return (*configState)(atomic.LoadPointer(shared))
+}
+
+func (s *configState) current() *Snapshot {
+	snapshot := s.snapshot.Load()
+	if snapshot == nil {
+		return &Snapshot{}
+	}
+
+	return snapshot
+}
+
+// recordDefault remembers a node populated from a config_default tag, so
+// that it can be explained. Defaults are kept apart from the snapshots, as
+// they come from the struct being populated rather than from loading.
+func (s *configState) recordDefault(section string, configNode ConfigNode) {
+	s.defaultsMutex.Lock()
+	defer s.defaultsMutex.Unlock()
+
+	if s.defaults == nil {
+		s.defaults = make(map[string]map[string]ConfigNode)
+	}
+
+	if s.defaults[section] == nil {
+		s.defaults[section] = make(map[string]ConfigNode)
+	}
+
+	s.defaults[section][configNode.Name] = configNode
+}
+
+// rememberPopulated records the struct LoadAndPopulate populated, and
+// whether it did so from environment variables alone, so that reloads load
+// the config the same way and check the same struct for unknown nodes.
+func (s *configState) rememberPopulated(configType reflect.Type, fromEnvironment bool) {
+	s.subscriptionMutex.Lock()
+	defer s.subscriptionMutex.Unlock()
+
+	s.populatedType = configType
+	s.fromEnvironment = fromEnvironment
+}
+
+// defaultNode returns the node last populated from a config_default tag
+// for a section and key.
+func (s *configState) defaultNode(section string, key string) (ConfigNode, bool) {
+	s.defaultsMutex.Lock()
+	defer s.defaultsMutex.Unlock()
+
+	configNode, ok := s.defaults[section][key]
+	return configNode, ok
+}
+
+// update swaps in a copy of the current snapshot changed by update. Updates
+// are serialised so that none are lost, and must replace the maps they
+// change rather than modifying them.
+func (s *configState) update(update func(snapshot *Snapshot) error) error {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+
+	next := *s.current()
+	err := update(&next)
+	if err != nil {
+		return err
+	}
+
+	s.snapshot.Store(&next)
+	return nil
+}
+
+// swap replaces the current snapshot with a newly loaded one, serialised
+// with other updates so none of them overwrite it.
+func (s *configState) swap(snapshot *Snapshot) {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+
+	s.snapshot.Store(snapshot)
+}
+
+// sameData reports whether two snapshots share the same stored values.
+// Updates replace the data rather than changing it, so the values are the
+// same only if the map is.
+func sameData(a, b map[string]map[string]map[string]interface{}) bool {
+	return reflect.ValueOf(a).UnsafePointer() == reflect.ValueOf(b).UnsafePointer()
+}
+
+// cloneData deep copies the stored values down to the node level, so that
+// nodes can be changed without affecting earlier snapshots.
+func cloneData(data map[string]map[string]map[string]interface{}) map[string]map[string]map[string]interface{} {
+	clone := make(map[string]map[string]map[string]interface{}, len(data))
+	for sectionKey, sectionValue := range data {
+		clone[sectionKey] = make(map[string]map[string]interface{}, len(sectionValue))
+		for nodeKey, nodeValue := range sectionValue {
+			clone[sectionKey][nodeKey] = maps.Clone(nodeValue)
+		}
+	}
+
+	return clone
+}
@@ -0,0 +1,45 @@
+package kmsconfig
+
+const (
+	// SourceFile a value read from an environment file, located by its path.
+	SourceFile SourceKind = "file"
+	// SourceOverride a value overridden by a VIDSY_VAR_* environment
+	// variable, located by the variable name.
+	SourceOverride SourceKind = "override"
+	// SourceEnvironment a value read from a VIDSY_VAR_* environment variable
+	// when there is no environment file, located by the variable name.
+	SourceEnvironment SourceKind = "environment"
+	// SourceDotenv a VIDSY_VAR_* variable set from a dotenv file, located
+	// as "path:VARIABLE".
+	SourceDotenv SourceKind = "dotenv"
+	// SourceDefault a value taken from a config_default struct tag, located
+	// by the struct field name.
+	SourceDefault SourceKind = "default"
+	// SourceDecrypted a secure value that was decrypted, located by the
+	// decrypter used.
+	SourceDecrypted SourceKind = "decrypted"
+	// SourceSSM a value fetched from SSM Parameter Store, located by the
+	// parameter name.
+	SourceSSM SourceKind = "ssm"
+	// SourceSecretsManager a value fetched from Secrets Manager, located by
+	// the secret name and any version stage or JSON key.
+	SourceSecretsManager SourceKind = "secretsmanager"
+	// SourceVault a value read from a Vault KV v2 secret, located by the
+	// mount, path and any field.
+	SourceVault SourceKind = "vault"
+)
+
+type (
+	// SourceKind describes where a config value came from.
+	SourceKind string
+
+	// Source a step in resolving the value of a config node.
+	Source struct {
+		Kind     SourceKind
+		Location string
+	}
+)
+
+func (s Source) String() string {
+	return string(s.Kind) + " " + s.Location
+}
@@ -0,0 +1,128 @@
+package kmsconfig
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+const (
+	ssmReferencePrefix = "ssm://"
+	ssmFieldName       = "ssm"
+	// ssmBatchSize is the most names GetParameters accepts in one call.
+	ssmBatchSize = 10
+)
+
+type (
+	// SSMAPI the SSM operations used to resolve references. *ssm.Client from
+	// aws-sdk-go-v2 implements it.
+	SSMAPI interface {
+		GetParameters(ctx context.Context, params *ssm.GetParametersInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error)
+	}
+)
+
+// defaultSSMClient creates a client for the default AWS config once, the
+// first time SSM is used without an SSMClient.
+var defaultSSMClient = sync.OnceValues(func() (SSMAPI, error) {
+	awsConfig, err := defaultAWSConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error loading default AWS config for SSM: %w", err)
+	}
+
+	return ssm.NewFromConfig(awsConfig), nil
+})
+
+// ssmReference returns the name of the SSM parameter a node refers to,
+// either with an ssm field or an ssm:// value, given the node's value after
+// any override has been applied.
+func ssmReference(nodeValue map[string]interface{}, value interface{}, overridden bool) (string, bool) {
+	if name, ok := nodeValue[ssmFieldName].(string); ok && !overridden {
+		return name, true
+	}
+
+	if stringValue, ok := value.(string); ok && strings.HasPrefix(stringValue, ssmReferencePrefix) {
+		return strings.TrimPrefix(stringValue, ssmReferencePrefix), true
+	}
+
+	return "", false
+}
+
+// fetchSSMParameters fetches the named parameters with decryption, using
+// GetParameters in batches. Parameters that don't exist are left out of the
+// result.
+func (c Config) fetchSSMParameters(ctx context.Context, names []string) (map[string]types.Parameter, error) {
+	parameters := make(map[string]types.Parameter, len(names))
+	if len(names) == 0 {
+		return parameters, nil
+	}
+
+	client, err := c.ssmClient()
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+
+	for i := 0; i < len(names); i += ssmBatchSize {
+		batch := names[i:min(i+ssmBatchSize, len(names))]
+		output, err := client.GetParameters(ctx, &ssm.GetParametersInput{
+			Names:          batch,
+			WithDecryption: aws.Bool(true),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error fetching SSM parameters: %s", err.Error())
+		}
+
+		for _, parameter := range output.Parameters {
+			parameters[aws.ToString(parameter.Name)+aws.ToString(parameter.Selector)] = parameter
+		}
+	}
+
+	c.logger().Debug("Fetched SSM parameters", "count", len(names), "duration", time.Since(start))
+	return parameters, nil
+}
+
+// resolveSSMReference sets the value of a node that refers to an SSM
+// parameter. SecureString parameters make the node secure.
+func resolveSSMReference(node *ConfigNode, name string, parameters map[string]types.Parameter) error {
+	parameter, ok := parameters[name]
+	if !ok {
+		return fmt.Errorf("SSM parameter '%s' not found", name)
+	}
+
+	if parameter.Type == types.ParameterTypeSecureString {
+		node.Secure = true
+	}
+
+	if node.Secure {
+		node.EncryptedValue = ssmReferencePrefix + name
+	}
+
+	node.Value = aws.ToString(parameter.Value)
+	if parameter.Type == types.ParameterTypeStringList {
+		var values []interface{}
+		for _, value := range strings.Split(aws.ToString(parameter.Value), ",") {
+			values = append(values, value)
+		}
+		node.Value = values
+	}
+
+	node.Sources = append(node.Sources, Source{SourceSSM, name})
+	return nil
+}
+
+// ssmClient returns the SSMClient, or a client for the default AWS config
+// if it isn't set.
+func (c Config) ssmClient() (SSMAPI, error) {
+	if c.SSMClient == nil {
+		return defaultSSMClient()
+	}
+
+	return c.SSMClient, nil
+}
@@ -0,0 +1,105 @@
+package kmsconfig
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	// UnknownNodesIgnore silently ignores nodes no struct field uses.
+	UnknownNodesIgnore UnknownNodePolicy = iota
+	// UnknownNodesLog logs each node no struct field uses through the
+	// LogHandler.
+	UnknownNodesLog
+	// UnknownNodesError fails population if any node isn't used by a
+	// struct field.
+	UnknownNodesError
+)
+
+var envConfigReservedVariables = map[string]struct{}{
+	"VIDSY_VAR_CONFIG_EXCLUSIVELY_FROM_ENVIRONMENT": {},
+	"VIDSY_VAR_SECURED_ENVIRONMENT_VARIABLES":       {},
+}
+
+type (
+	// UnknownNodePolicy controls what Populate and LoadAndPopulate do with
+	// config nodes, or VIDSY_VAR_* variables in env-only mode, that no
+	// struct field maps to.
+	UnknownNodePolicy int
+)
+
+// UnmappedNodes returns the sections and nodes in the loaded config that no
+// field of the struct config points to maps to. A section no field maps to
+// is returned by its name alone, otherwise nodes are returned as
+// "section.key".
+func (c Config) UnmappedNodes(config interface{}) ([]string, error) {
+	configType := reflect.TypeOf(config)
+	if configType == nil || configType.Kind() != reflect.Ptr || configType.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("Struct must be passed by reference")
+	}
+
+	return c.unmappedNodes(configType.Elem()), nil
+}
+
+// unmappedNodes returns the sections and nodes in the config that no field
+// of the struct type maps to. A section no field maps to is returned by its
+// name alone, otherwise nodes are returned as "section.key".
+func (c Config) unmappedNodes(configType reflect.Type) []string {
+	mappedNodes := make(map[string]map[string]bool)
+
+	for i := 0; i < configType.NumField(); i++ {
+		nodeFieldType := configType.Field(i)
+		nodeTag := nodeFieldType.Tag.Get(configNodeName)
+		if nodeTag == configOmitField || nodeFieldType.Type.Kind() != reflect.Struct {
+			continue
+		}
+
+		if _, ok := mappedNodes[nodeTag]; !ok {
+			mappedNodes[nodeTag] = make(map[string]bool)
+		}
+
+		for j := 0; j < nodeFieldType.Type.NumField(); j++ {
+			sectionTag := nodeFieldType.Type.Field(j).Tag.Get(configNodeName)
+			mappedNodes[nodeTag][sectionTag] = true
+		}
+	}
+
+	var unmapped []string
+	for sectionKey, section := range c.Snapshot().sections {
+		mappedKeys, ok := mappedNodes[sectionKey]
+		if !ok {
+			unmapped = append(unmapped, sectionKey)
+			continue
+		}
+
+		for nodeKey := range section.Nodes {
+			if !mappedKeys[nodeKey] {
+				unmapped = append(unmapped, sectionKey+"."+nodeKey)
+			}
+		}
+	}
+
+	sort.Strings(unmapped)
+	return unmapped
+}
+
+// reportUnmappedNodes applies the UnknownNodes policy to the nodes, or
+// environment variables, that no struct field used.
+func (c Config) reportUnmappedNodes(kind string, nodes []string) error {
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	switch c.UnknownNodes {
+	case UnknownNodesLog:
+		for _, node := range nodes {
+			c.logger().Warn(fmt.Sprintf("Unused %s found", kind), "node", node)
+		}
+	case UnknownNodesError:
+		return fmt.Errorf("found %d unused %s(s): %s", len(nodes), kind, strings.Join(nodes, ", "))
+	}
+
+	return nil
+}
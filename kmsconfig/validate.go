@@ -0,0 +1,100 @@
+package kmsconfig
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+type (
+	// ValidationError lists every problem found when validating a config
+	// file, rather than stopping at the first one.
+	ValidationError struct {
+		Problems []string
+	}
+)
+
+func (v *ValidationError) Error() string {
+	return fmt.Sprintf(
+		"config failed validation with %d problem(s):\n  %s",
+		len(v.Problems),
+		strings.Join(v.Problems, "\n  "),
+	)
+}
+
+// Validate reads the environment file and checks that every node has a
+// value and that every secure value decrypts, without stopping at the first
+// failure. It returns a *ValidationError listing the problems found. The
+// loaded config is left untouched.
+func (c *Config) Validate() error {
+	_, problems, err := c.validateNodes()
+	if err != nil {
+		return err
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{problems}
+	}
+
+	return nil
+}
+
+// ValidateAgainst runs the checks made by Validate and then the Populate
+// mapping for the struct config points to, reporting missing nodes, type
+// mismatches, duration tag problems and nodes in the file that no field
+// uses. The struct and the loaded config are left untouched.
+func (c *Config) ValidateAgainst(config interface{}) error {
+	configPointer := reflect.ValueOf(config)
+	if configPointer.Kind() != reflect.Ptr || configPointer.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("Struct must be passed by reference")
+	}
+
+	candidate, problems, err := c.validateNodes()
+	if err != nil {
+		return err
+	}
+
+	configType := configPointer.Elem().Type()
+	for _, err := range candidate.populate(reflect.New(configType).Interface(), false) {
+		problems = append(problems, err.Error())
+	}
+
+	for _, node := range candidate.unmappedNodes(configType) {
+		problems = append(problems, fmt.Sprintf("config node '%s' isn't used by any field", node))
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{problems}
+	}
+
+	return nil
+}
+
+// validateNodes reads the environment file and returns the problems found
+// in its nodes, along with a candidate config holding what was read so
+// that it can be populated without changing the loaded config.
+func (c *Config) validateNodes() (Config, []string, error) {
+	data, contents, err := c.readData()
+	if err != nil {
+		return Config{}, nil, err
+	}
+
+	var problems []string
+	for sectionKey, sectionValue := range data {
+		for nodeKey, nodeValue := range sectionValue {
+			if _, ok := nodeValue[valueFieldName]; !ok && !isReference(nodeValue) {
+				problems = append(problems, fmt.Sprintf("config node %s.%s has no value", sectionKey, nodeKey))
+			}
+		}
+	}
+
+	sections, errs := c.parseSections(context.Background(), data, false)
+	for _, err := range errs {
+		problems = append(problems, err.Error())
+	}
+
+	sort.Strings(problems)
+	return c.withSnapshot(&Snapshot{env: c.Env, data: data, contents: contents, sections: sections}), problems, nil
+}
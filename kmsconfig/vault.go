@@ -0,0 +1,382 @@
+package kmsconfig
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	vaultReferencePrefix     = "vault://"
+	vaultDefaultTransitMount = "transit"
+	vaultKubernetesJWTPath   = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+)
+
+type (
+	// VaultClient decrypts secure values with Vault's Transit secrets engine
+	// and fetches vault://mount/path#field references from KV v2. Set it as
+	// the Config's Decrypter to decrypt vault:v1: ciphertext, and as its
+	// VaultClient to resolve references.
+	VaultClient struct {
+		Address      string
+		Auth         VaultAuth
+		HTTPClient   *http.Client
+		TransitMount string
+		TransitKey   string
+
+		mutex sync.Mutex
+		token string
+	}
+
+	// VaultAuth logs in to Vault, returning a client token.
+	VaultAuth interface {
+		Login(client *VaultClient) (string, error)
+	}
+
+	// VaultTokenAuth authenticates with a token, defaulting to VAULT_TOKEN.
+	VaultTokenAuth struct {
+		Token string
+	}
+
+	// VaultAppRoleAuth authenticates with an AppRole role and secret ID. Mount
+	// defaults to "approle".
+	VaultAppRoleAuth struct {
+		Mount    string
+		RoleID   string
+		SecretID string
+	}
+
+	// VaultKubernetesAuth authenticates as a Kubernetes service account.
+	// Mount defaults to "kubernetes" and JWTPath to the token mounted into
+	// pods.
+	VaultKubernetesAuth struct {
+		Mount   string
+		Role    string
+		JWTPath string
+	}
+
+	// vaultReference is a node value of the form vault://mount/path#field.
+	vaultReference struct {
+		mount    string
+		path     string
+		field    string
+		location string
+	}
+
+	fetchedVaultSecret struct {
+		data map[string]interface{}
+		err  error
+	}
+
+	vaultResponse struct {
+		Data   json.RawMessage `json:"data"`
+		Auth   *vaultAuthData  `json:"auth"`
+		Errors []string        `json:"errors"`
+	}
+
+	vaultAuthData struct {
+		ClientToken string `json:"client_token"`
+	}
+)
+
+// NewVaultClient creates a client for the Vault server at address, or at
+// VAULT_ADDR if address is empty, that decrypts with the Transit key named
+// transitKey.
+func NewVaultClient(address string, auth VaultAuth, transitKey string) *VaultClient {
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+
+	return &VaultClient{
+		Address:    address,
+		Auth:       auth,
+		TransitKey: transitKey,
+	}
+}
+
+func (v *VaultClient) String() string {
+	return "vault"
+}
+
+// Decrypt decrypts vault:v1: ciphertext with the Transit key.
+func (v *VaultClient) Decrypt(ciphertext string) (string, error) {
+	var data struct {
+		Plaintext string `json:"plaintext"`
+	}
+
+	err := v.request(http.MethodPost, v.transitPath("decrypt"), map[string]string{"ciphertext": ciphertext}, &data)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := base64.StdEncoding.DecodeString(data.Plaintext)
+	if err != nil {
+		return "", fmt.Errorf("could not base64 decode Vault plaintext: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+// Encrypt encrypts the plaintext with the named Transit key, or the
+// client's TransitKey if keyName is empty, returning vault:v1: ciphertext.
+func (v *VaultClient) Encrypt(keyName string, plaintext string) (string, error) {
+	if keyName == "" {
+		keyName = v.TransitKey
+	}
+
+	var data struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+
+	body := map[string]string{"plaintext": base64.StdEncoding.EncodeToString([]byte(plaintext))}
+	err := v.request(http.MethodPost, v.transitMount()+"/encrypt/"+keyName, body, &data)
+	if err != nil {
+		return "", err
+	}
+
+	return data.Ciphertext, nil
+}
+
+// readKV reads the data of a KV v2 secret.
+func (v *VaultClient) readKV(mount string, path string) (map[string]interface{}, error) {
+	var data struct {
+		Data map[string]interface{} `json:"data"`
+	}
+
+	err := v.request(http.MethodGet, mount+"/data/"+path, nil, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.Data, nil
+}
+
+func (v *VaultClient) transitMount() string {
+	if v.TransitMount == "" {
+		return vaultDefaultTransitMount
+	}
+
+	return v.TransitMount
+}
+
+func (v *VaultClient) transitPath(operation string) string {
+	return v.transitMount() + "/" + operation + "/" + v.TransitKey
+}
+
+// request calls the Vault API with a client token, logging in first if
+// there isn't one and again if the token has been rejected.
+func (v *VaultClient) request(method string, path string, body interface{}, data interface{}) error {
+	token, err := v.clientToken(false)
+	if err != nil {
+		return err
+	}
+
+	statusCode, err := v.call(method, path, token, body, data)
+	if statusCode == http.StatusForbidden {
+		token, err = v.clientToken(true)
+		if err != nil {
+			return err
+		}
+
+		_, err = v.call(method, path, token, body, data)
+	}
+
+	return err
+}
+
+func (v *VaultClient) clientToken(renew bool) (string, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if v.token != "" && !renew {
+		return v.token, nil
+	}
+
+	if v.Auth == nil {
+		return "", fmt.Errorf("no Vault auth method configured")
+	}
+
+	token, err := v.Auth.Login(v)
+	if err != nil {
+		return "", fmt.Errorf("error logging in to Vault: %w", err)
+	}
+
+	v.token = token
+	return token, nil
+}
+
+// login calls an auth method's login endpoint, returning the client token.
+func (v *VaultClient) login(mount string, body interface{}) (string, error) {
+	var response vaultResponse
+	_, err := v.call(http.MethodPost, "auth/"+mount+"/login", "", body, &response)
+	if err != nil {
+		return "", err
+	}
+
+	if response.Auth == nil || response.Auth.ClientToken == "" {
+		return "", fmt.Errorf("Vault login to %s returned no client token", mount)
+	}
+
+	return response.Auth.ClientToken, nil
+}
+
+// call makes a single Vault API request, decoding the response's data into
+// data, or the whole response when data is a *vaultResponse.
+func (v *VaultClient) call(method string, path string, token string, body interface{}, data interface{}) (int, error) {
+	var requestBody io.Reader
+	if body != nil {
+		encodedBody, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		requestBody = bytes.NewReader(encodedBody)
+	}
+
+	request, err := http.NewRequest(method, strings.TrimSuffix(v.Address, "/")+"/v1/"+path, requestBody)
+	if err != nil {
+		return 0, err
+	}
+
+	if token != "" {
+		request.Header.Set("X-Vault-Token", token)
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := v.httpClient().Do(request)
+	if err != nil {
+		return 0, fmt.Errorf("error calling Vault: %w", err)
+	}
+	defer response.Body.Close()
+
+	var decoded vaultResponse
+	err = json.NewDecoder(response.Body).Decode(&decoded)
+	if err != nil && err != io.EOF {
+		return response.StatusCode, fmt.Errorf("error decoding Vault response: %w", err)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return response.StatusCode, fmt.Errorf(
+			"Vault returned %d for %s: %s",
+			response.StatusCode, path, strings.Join(decoded.Errors, ", "),
+		)
+	}
+
+	if fullResponse, ok := data.(*vaultResponse); ok {
+		*fullResponse = decoded
+		return response.StatusCode, nil
+	}
+
+	err = json.Unmarshal(decoded.Data, data)
+	if err != nil {
+		return response.StatusCode, fmt.Errorf("error decoding Vault response data: %w", err)
+	}
+
+	return response.StatusCode, nil
+}
+
+func (v *VaultClient) httpClient() *http.Client {
+	if v.HTTPClient == nil {
+		return &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return v.HTTPClient
+}
+
+func (a VaultTokenAuth) Login(*VaultClient) (string, error) {
+	if a.Token == "" {
+		return os.Getenv("VAULT_TOKEN"), nil
+	}
+
+	return a.Token, nil
+}
+
+func (a VaultAppRoleAuth) Login(client *VaultClient) (string, error) {
+	mount := a.Mount
+	if mount == "" {
+		mount = "approle"
+	}
+
+	return client.login(mount, map[string]string{"role_id": a.RoleID, "secret_id": a.SecretID})
+}
+
+func (a VaultKubernetesAuth) Login(client *VaultClient) (string, error) {
+	mount := a.Mount
+	if mount == "" {
+		mount = "kubernetes"
+	}
+
+	jwtPath := a.JWTPath
+	if jwtPath == "" {
+		jwtPath = vaultKubernetesJWTPath
+	}
+
+	jwt, err := os.ReadFile(jwtPath)
+	if err != nil {
+		return "", err
+	}
+
+	return client.login(mount, map[string]string{"role": a.Role, "jwt": strings.TrimSpace(string(jwt))})
+}
+
+func parseVaultReference(value interface{}) (vaultReference, bool) {
+	stringValue, ok := value.(string)
+	if !ok || !strings.HasPrefix(stringValue, vaultReferencePrefix) {
+		return vaultReference{}, false
+	}
+
+	location := strings.TrimPrefix(stringValue, vaultReferencePrefix)
+	secret, field, _ := strings.Cut(location, "#")
+	mount, path, _ := strings.Cut(secret, "/")
+
+	return vaultReference{mount, path, field, location}, true
+}
+
+// fetchVaultSecrets reads each KV v2 secret once, recording the data or
+// error for each.
+func (c Config) fetchVaultSecrets(secrets map[string]fetchedVaultSecret) {
+	for secret := range secrets {
+		if c.VaultClient == nil {
+			secrets[secret] = fetchedVaultSecret{err: fmt.Errorf("no VaultClient configured")}
+			continue
+		}
+
+		mount, path, _ := strings.Cut(secret, "/")
+		data, err := c.VaultClient.readKV(mount, path)
+		secrets[secret] = fetchedVaultSecret{data, err}
+	}
+}
+
+// resolveVaultReference sets the value of a node that refers to a KV v2
+// secret, to one of its fields or, without a field, to all of its data. The
+// node is always secure.
+func resolveVaultReference(node *ConfigNode, reference vaultReference, secrets map[string]fetchedVaultSecret) error {
+	fetched := secrets[reference.mount+"/"+reference.path]
+	if fetched.err != nil {
+		return fmt.Errorf("error reading Vault secret '%s/%s': %s", reference.mount, reference.path, fetched.err.Error())
+	}
+
+	var value interface{} = fetched.data
+	if reference.field != "" {
+		fieldValue, ok := fetched.data[reference.field]
+		if !ok {
+			return fmt.Errorf("field '%s' not found in Vault secret '%s/%s'", reference.field, reference.mount, reference.path)
+		}
+		value = fieldValue
+	}
+
+	node.Secure = true
+	node.EncryptedValue = vaultReferencePrefix + reference.location
+	node.Value = value
+	node.Sources = append(node.Sources, Source{SourceVault, reference.location})
+
+	return nil
+}